@@ -0,0 +1,254 @@
+// Command mockidp runs a minimal OpenID Connect provider for local development.
+// It signs in whoever fills in its form, so never expose it outside a dev machine.
+//
+// Point the app at it with:
+//
+//	OIDC_ISSUER_URL=http://localhost:9000
+//	OIDC_CLIENT_ID=golang-base
+//	OIDC_CLIENT_SECRET=mock-secret
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/oidc"
+	"golang-base/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	keyID   = "mock-key"
+	codeTTL = time.Minute
+)
+
+// authorization is an issued authorization code waiting to be redeemed
+type authorization struct {
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Nonce         string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	ExpiresAt     time.Time
+}
+
+// provider holds the mock provider's configuration and in-memory state
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+var authorizeForm = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html><head><title>Mock Identity Provider</title></head>
+<body style="font-family: sans-serif; max-width: 420px; margin: 40px auto">
+<h2>Mock Identity Provider</h2>
+<p>Signing in to <code>{{.ClientID}}</code>. Any values are accepted.</p>
+<form method="POST">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}
+<p><label>Email<br><input name="email" type="email" value="jane@example.com" required></label></p>
+<p><label>Subject (leave empty to derive from email)<br><input name="sub"></label></p>
+<p><label>Given name<br><input name="given_name" value="Jane"></label></p>
+<p><label>Family name<br><input name="family_name" value="Doe"></label></p>
+<p><label><input name="email_verified" type="checkbox" value="true" checked> Email verified</label></p>
+<p><button type="submit">Sign in</button> <button type="submit" name="deny" value="1">Deny</button></p>
+</form>
+</body></html>`))
+
+func main() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal("Failed to generate signing key:", err)
+	}
+
+	port := getEnv("MOCK_IDP_PORT", "9000")
+	p := &provider{
+		issuer:       strings.TrimRight(getEnv("MOCK_IDP_ISSUER", "http://localhost:"+port), "/"),
+		clientID:     getEnv("MOCK_IDP_CLIENT_ID", "golang-base"),
+		clientSecret: getEnv("MOCK_IDP_CLIENT_SECRET", "mock-secret"),
+		key:          key,
+		codes:        make(map[string]authorization),
+	}
+
+	// Form values are kept in the code store after the request, so they must not alias fasthttp buffers
+	app := fiber.New(fiber.Config{Immutable: true})
+	app.Get("/.well-known/openid-configuration", p.discovery)
+	app.Get("/jwks", p.jwks)
+	app.Get("/authorize", p.authorizePage)
+	app.Post("/authorize", p.authorize)
+	app.Post("/token", p.token)
+
+	log.Printf("Mock OIDC provider %s (client %s)", p.issuer, p.clientID)
+	log.Fatal(app.Listen(":" + port))
+}
+
+func (p *provider) discovery(c *fiber.Ctx) error {
+	return c.JSON(oidc.Discovery{
+		Issuer:                p.issuer,
+		AuthorizationEndpoint: p.issuer + "/authorize",
+		TokenEndpoint:         p.issuer + "/token",
+		JWKSURI:               p.issuer + "/jwks",
+		CodeChallengeMethods:  []string{"S256"},
+	})
+}
+
+func (p *provider) jwks(c *fiber.Ctx) error {
+	jwk, err := auth.NewJWK(keyID, jwt.SigningMethodRS256.Alg(), &p.key.PublicKey)
+	if err != nil {
+		return err
+	}
+	return c.JSON(auth.JWKSet{Keys: []auth.JWK{jwk}})
+}
+
+// authorizePage shows the sign-in form for an authorization request
+func (p *provider) authorizePage(c *fiber.Ctx) error {
+	if c.Query("client_id") != p.clientID || c.Query("response_type") != "code" {
+		return c.Status(fiber.StatusBadRequest).SendString("unknown client_id or unsupported response_type")
+	}
+	if c.Query("code_challenge") == "" || c.Query("code_challenge_method") != "S256" {
+		return c.Status(fiber.StatusBadRequest).SendString("PKCE with S256 is required")
+	}
+
+	params := make(map[string]string)
+	for _, name := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge"} {
+		params[name] = c.Query(name)
+	}
+
+	c.Type("html")
+	return authorizeForm.Execute(c, fiber.Map{"ClientID": p.clientID, "Params": params})
+}
+
+// authorize issues an authorization code for the submitted user and redirects back to the client
+func (p *provider) authorize(c *fiber.Ctx) error {
+	redirect, err := url.Parse(c.FormValue("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid redirect_uri")
+	}
+
+	query := redirect.Query()
+	query.Set("state", c.FormValue("state"))
+
+	if c.FormValue("deny") != "" {
+		query.Set("error", "access_denied")
+		query.Set("error_description", "The user denied the request")
+		redirect.RawQuery = query.Encode()
+		return c.Redirect(redirect.String())
+	}
+
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	email := strings.TrimSpace(c.FormValue("email"))
+	subject := c.FormValue("sub")
+	if subject == "" {
+		subject = "mock|" + strings.ToLower(email)
+	}
+
+	p.mu.Lock()
+	p.codes[code] = authorization{
+		ClientID:      c.FormValue("client_id"),
+		RedirectURI:   c.FormValue("redirect_uri"),
+		CodeChallenge: c.FormValue("code_challenge"),
+		Nonce:         c.FormValue("nonce"),
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: c.FormValue("email_verified") == "true",
+		GivenName:     c.FormValue("given_name"),
+		FamilyName:    c.FormValue("family_name"),
+		ExpiresAt:     time.Now().Add(codeTTL),
+	}
+	p.mu.Unlock()
+
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+	return c.Redirect(redirect.String())
+}
+
+// token redeems an authorization code for an ID token
+func (p *provider) token(c *fiber.Ctx) error {
+	clientID, clientSecret := c.FormValue("client_id"), c.FormValue("client_secret")
+	if username, password, ok := utils.ParseBasicAuth(c.Get(fiber.HeaderAuthorization)); ok {
+		clientID, clientSecret = username, password
+	}
+	if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1 {
+		return tokenError(c, fiber.StatusUnauthorized, "invalid_client")
+	}
+
+	if c.FormValue("grant_type") != "authorization_code" {
+		return tokenError(c, fiber.StatusBadRequest, "unsupported_grant_type")
+	}
+
+	p.mu.Lock()
+	grant, ok := p.codes[c.FormValue("code")]
+	delete(p.codes, c.FormValue("code"))
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(grant.ExpiresAt) || grant.ClientID != clientID ||
+		grant.RedirectURI != c.FormValue("redirect_uri") ||
+		oidc.CodeChallenge(c.FormValue("code_verifier")) != grant.CodeChallenge {
+		return tokenError(c, fiber.StatusBadRequest, "invalid_grant")
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.issuer,
+		"sub":            grant.Subject,
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          grant.Nonce,
+		"email":          grant.Email,
+		"email_verified": grant.EmailVerified,
+		"given_name":     grant.GivenName,
+		"family_name":    grant.FamilyName,
+		"name":           strings.TrimSpace(grant.GivenName + " " + grant.FamilyName),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"access_token": uuid.NewString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(c *fiber.Ctx, status int, code string) error {
+	return c.Status(status).JSON(fiber.Map{"error": code})
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
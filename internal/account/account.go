@@ -0,0 +1,161 @@
+// Package account creates user accounts, one at a time or in bulk from CSV and NDJSON files.
+// Registration, invitations, the admin API and the import command share it, so every
+// account is created with the same checks.
+package account
+
+import (
+	"errors"
+	"time"
+
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrExists is returned when the email address is already registered
+	ErrExists = errors.New("user already exists")
+	// ErrUnknownRole is returned for roles that do not exist
+	ErrUnknownRole = errors.New("unknown role")
+	// ErrRoleNotAllowed is returned when a role other than the default is given without Options.AllowRoles
+	ErrRoleNotAllowed = errors.New("assigning a role requires the roles:manage permission")
+	// ErrAdminMembership is returned when the admin role is given within an organization
+	ErrAdminMembership = errors.New("the admin role cannot be given within an organization")
+)
+
+// Create hashes the password and creates the user, unless the email address is taken.
+// The user's Active field is stored as given.
+func Create(db *gorm.DB, cost int, user *models.User, password string) error {
+	var existing int64
+	if err := db.Model(&models.User{}).Where("email = ?", user.Email).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return ErrExists
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hashedPassword)
+
+	if err := db.Create(user).Error; err != nil {
+		return err
+	}
+	// The column defaults to true, so GORM leaves a false value out of the insert
+	if !user.Active {
+		return db.Model(user).Update("active", false).Error
+	}
+	return nil
+}
+
+// Options control how admins create accounts
+type Options struct {
+	// OrganizationID makes new users members of the organization, with the requested
+	// role as their membership role instead of their primary role
+	OrganizationID *uint
+	// AllowRoles permits roles other than the default user role
+	AllowRoles bool
+
+	// DryRun validates and writes the import, then rolls it back
+	DryRun bool
+	// BatchSize commits imports every BatchSize rows, skipping invalid rows; zero imports
+	// the whole file in one transaction that is rolled back if any row is invalid
+	BatchSize int
+	// Start is the first row to import, to resume a batched import that stopped
+	Start int
+	// Progress is called after each committed batch with the last row it covered
+	Progress func(row int, result *Result)
+}
+
+// Service creates accounts on behalf of admins
+type Service struct {
+	db       *gorm.DB
+	config   *config.Config
+	validate *validator.Validate
+}
+
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{
+		db:       db,
+		config:   cfg,
+		validate: validator.New(),
+	}
+}
+
+// CreateUser validates the request and creates the user with tx. Without a password the
+// account gets an unusable random one, and the user chooses theirs through password reset.
+// Validation failures are returned as validator.ValidationErrors.
+func (s *Service) CreateUser(tx *gorm.DB, req *models.CreateUserRequest, opts *Options) (*models.User, error) {
+	if err := s.validate.Struct(req); err != nil {
+		return nil, err
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+	if opts.OrganizationID != nil && role == models.RoleAdmin {
+		return nil, ErrAdminMembership
+	}
+	if role != models.RoleUser && !opts.AllowRoles {
+		return nil, ErrRoleNotAllowed
+	}
+	var roles int64
+	if err := tx.Model(&models.Role{}).Where("name = ?", role).Count(&roles).Error; err != nil {
+		return nil, err
+	}
+	if roles == 0 {
+		return nil, ErrUnknownRole
+	}
+
+	user := models.User{
+		Email:      req.Email,
+		FirstName:  req.FirstName,
+		LastName:   req.LastName,
+		Role:       role,
+		Active:     req.Active == nil || *req.Active,
+		Department: req.Department,
+	}
+	if opts.OrganizationID != nil {
+		user.Role = models.RoleUser
+	}
+	if req.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	password, cost := req.Password, s.config.BCryptCost
+	if password == "" {
+		// Nobody knows the random password, so hashing it slowly would only slow imports down
+		var err error
+		if password, err = utils.GenerateRandomToken(32); err != nil {
+			return nil, err
+		}
+		cost = bcrypt.MinCost
+	}
+	if err := Create(tx, cost, &user, password); err != nil {
+		return nil, err
+	}
+
+	if opts.OrganizationID != nil {
+		membership := models.Membership{OrganizationID: *opts.OrganizationID, UserID: user.ID, Role: role}
+		if err := tx.Create(&membership).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// rowError reports whether err is a problem with the submitted data rather than a failure
+func rowError(err error) bool {
+	var validationErrors validator.ValidationErrors
+	return errors.As(err, &validationErrors) || errors.Is(err, errInvalidRow) ||
+		errors.Is(err, ErrExists) || errors.Is(err, ErrUnknownRole) ||
+		errors.Is(err, ErrRoleNotAllowed) || errors.Is(err, ErrAdminMembership)
+}
@@ -0,0 +1,318 @@
+package account
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Import file formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var (
+	// ErrInvalidFile is returned when an import cannot be read at all, such as for an
+	// unknown format or CSV header
+	ErrInvalidFile = errors.New("invalid import file")
+
+	errInvalidRow = errors.New("invalid row")
+	errRollback   = errors.New("rollback")
+)
+
+// maxLineSize bounds a single NDJSON line
+const maxLineSize = 1 << 20
+
+// RowError describes why a row was not imported. Rows are numbered from 1, not counting
+// the CSV header or blank NDJSON lines.
+type RowError struct {
+	Row   int    `json:"row"`
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
+
+// Result summarizes an import. Imported counts the rows written, or that would have been
+// in a dry run. NextRow is set when the import stopped early, as the Start to resume from.
+type Result struct {
+	Rows     int        `json:"rows"`
+	Imported int        `json:"imported"`
+	Failed   int        `json:"failed"`
+	DryRun   bool       `json:"dry_run"`
+	Errors   []RowError `json:"errors"`
+	NextRow  int        `json:"next_row,omitempty"`
+}
+
+// Import creates the users listed in a CSV or NDJSON file. Each row is validated and
+// created like a single user; see Options for transactions, batches and dry runs.
+// When the import stops on a database error, the returned result tells where to resume.
+func (s *Service) Import(r io.Reader, format string, opts Options) (*Result, error) {
+	rows, err := newRowReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Start < 1 {
+		opts.Start = 1
+	}
+
+	result := &Result{DryRun: opts.DryRun, Errors: []RowError{}}
+	if opts.BatchSize <= 0 {
+		return result, s.importAll(rows, &opts, result)
+	}
+	if !opts.DryRun {
+		return result, s.importBatches(s.db, rows, &opts, result)
+	}
+
+	// A dry run keeps every batch until the end, so that later batches see earlier rows
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.importBatches(tx, rows, &opts, result); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if errors.Is(err, errRollback) {
+		err = nil
+	}
+	return result, err
+}
+
+// importAll imports every row in one transaction, kept only when all rows are valid
+func (s *Service) importAll(rows rowReader, opts *Options, result *Result) error {
+	batch := &Result{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := s.importRows(tx, rows, opts, 0, batch); err != nil {
+			return err
+		}
+		if batch.Failed > 0 || opts.DryRun {
+			return errRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollback) {
+		result.NextRow = opts.Start
+		return err
+	}
+
+	result.Rows, result.Failed, result.Errors = batch.Rows, batch.Failed, append(result.Errors, batch.Errors...)
+	if batch.Failed == 0 {
+		result.Imported = batch.Imported
+	}
+	return nil
+}
+
+// importBatches imports BatchSize rows per transaction, skipping invalid rows
+func (s *Service) importBatches(db *gorm.DB, rows rowReader, opts *Options, result *Result) error {
+	for {
+		batch := &Result{}
+		var last int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			last, err = s.importRows(tx, rows, opts, opts.BatchSize, batch)
+			return err
+		})
+		if err != nil {
+			// Rows are numbered consecutively, so the failed batch starts after the rows counted so far
+			result.NextRow = opts.Start + result.Rows
+			return err
+		}
+
+		result.Rows += batch.Rows
+		result.Imported += batch.Imported
+		result.Failed += batch.Failed
+		result.Errors = append(result.Errors, batch.Errors...)
+		if batch.Rows == 0 {
+			return nil
+		}
+		if opts.Progress != nil && !opts.DryRun {
+			opts.Progress(last, result)
+		}
+	}
+}
+
+// importRows creates up to limit rows (all for zero) with tx, recording invalid rows in
+// batch. It returns the number of the last row read.
+func (s *Service) importRows(tx *gorm.DB, rows rowReader, opts *Options, limit int, batch *Result) (int, error) {
+	last := 0
+	for limit == 0 || batch.Rows < limit {
+		row, req, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !rowError(err) {
+			return last, err
+		}
+		if row < opts.Start {
+			continue
+		}
+		last = row
+		batch.Rows++
+
+		if err == nil {
+			_, err = s.CreateUser(tx, req, opts)
+		}
+		if err == nil {
+			batch.Imported++
+			continue
+		}
+		if !rowError(err) {
+			return last, err
+		}
+
+		batch.Failed++
+		rowErr := RowError{Row: row, Error: err.Error()}
+		if req != nil {
+			rowErr.Email = req.Email
+		}
+		var validationErrors validator.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			rowErr.Error = utils.FormatValidationErrors(err)
+		}
+		batch.Errors = append(batch.Errors, rowErr)
+	}
+	return last, nil
+}
+
+// rowReader reads the rows of an import file. next returns io.EOF after the last row,
+// an error wrapping errInvalidRow for rows that cannot be parsed, and other errors
+// when the file cannot be read further.
+type rowReader interface {
+	next() (int, *models.CreateUserRequest, error)
+}
+
+func newRowReader(r io.Reader, format string) (rowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRows(r)
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		return &ndjsonRows{scanner: scanner}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown format %q, expected %s or %s", ErrInvalidFile, format, FormatCSV, FormatNDJSON)
+}
+
+// csvColumns are the CSV columns an import understands, named like the JSON fields
+var csvColumns = []string{"email", "password", "first_name", "last_name", "role", "department", "active", "email_verified"}
+
+// csvRows reads a CSV file whose header names the columns, in any order
+type csvRows struct {
+	reader  *csv.Reader
+	columns []string
+	row     int
+}
+
+func newCSVRows(r io.Reader) (*csvRows, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the CSV header: %v", ErrInvalidFile, err)
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[i] = strings.ToLower(strings.TrimSpace(name))
+		if !utils.Contains(csvColumns, columns[i]) {
+			return nil, fmt.Errorf("%w: unknown CSV column %q, expected %s", ErrInvalidFile, name, strings.Join(csvColumns, ", "))
+		}
+	}
+	if !utils.Contains(columns, "email") {
+		return nil, fmt.Errorf("%w: the CSV header has no email column", ErrInvalidFile)
+	}
+
+	return &csvRows{reader: reader, columns: columns}, nil
+}
+
+func (r *csvRows) next() (int, *models.CreateUserRequest, error) {
+	record, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, nil, io.EOF
+	}
+	r.row++
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return r.row, nil, fmt.Errorf("%w: %v", errInvalidRow, parseErr.Err)
+	}
+	if err != nil {
+		return r.row, nil, err
+	}
+
+	req := &models.CreateUserRequest{}
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		switch r.columns[i] {
+		case "email":
+			req.Email = value
+		case "password":
+			req.Password = value
+		case "first_name":
+			req.FirstName = value
+		case "last_name":
+			req.LastName = value
+		case "role":
+			req.Role = value
+		case "department":
+			req.Department = value
+		case "active":
+			if value != "" {
+				active, err := strconv.ParseBool(value)
+				if err != nil {
+					return r.row, req, fmt.Errorf("%w: active must be true or false", errInvalidRow)
+				}
+				req.Active = &active
+			}
+		case "email_verified":
+			if value != "" {
+				verified, err := strconv.ParseBool(value)
+				if err != nil {
+					return r.row, req, fmt.Errorf("%w: email_verified must be true or false", errInvalidRow)
+				}
+				req.EmailVerified = verified
+			}
+		}
+	}
+	return r.row, req, nil
+}
+
+// ndjsonRows reads one JSON object per line; blank lines are skipped
+type ndjsonRows struct {
+	scanner *bufio.Scanner
+	row     int
+}
+
+func (r *ndjsonRows) next() (int, *models.CreateUserRequest, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		r.row++
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		req := &models.CreateUserRequest{}
+		if err := decoder.Decode(req); err != nil {
+			return r.row, nil, fmt.Errorf("%w: %v", errInvalidRow, err)
+		}
+		return r.row, req, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return r.row + 1, nil, err
+	}
+	return 0, nil, io.EOF
+}
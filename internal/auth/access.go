@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"golang-base/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Grants are the roles of a user and the permissions they hold through them.
+// Assigned are the roles given to the user, primary role first; Roles adds the roles
+// they include according to the role hierarchy. Within an organization, OrganizationRole
+// is the role of the user's membership, which is also among Assigned.
+type Grants struct {
+	Assigned         []string
+	Roles            []string
+	Permissions      []string
+	OrganizationRole string
+}
+
+// AccessControl resolves the roles and permissions of users. Grants are cached for a
+// short time, like token versions, so authorization doesn't query the database on
+// every request; changes made through this instance take effect immediately.
+type AccessControl struct {
+	db        *gorm.DB
+	cacheTTL  time.Duration
+	hierarchy RoleHierarchy
+
+	mu     sync.RWMutex
+	grants map[grantsKey]cachedGrants
+}
+
+// grantsKey identifies cached grants; OrganizationID is zero outside organizations
+type grantsKey struct {
+	UserID         uint
+	OrganizationID uint
+}
+
+type cachedGrants struct {
+	grants    *Grants
+	expiresAt time.Time
+}
+
+// NewAccessControl creates an access control backed by the roles and permissions tables
+func NewAccessControl(db *gorm.DB, cacheTTL time.Duration, hierarchy RoleHierarchy) *AccessControl {
+	return &AccessControl{
+		db:        db,
+		cacheTTL:  cacheTTL,
+		hierarchy: hierarchy,
+		grants:    make(map[grantsKey]cachedGrants),
+	}
+}
+
+// Grants returns the roles and permissions of a user
+func (a *AccessControl) Grants(userID uint) (*Grants, error) {
+	return a.cached(grantsKey{UserID: userID}, func() (*Grants, error) {
+		var user models.User
+		if err := a.db.Select("id", "role").Where("id = ?", userID).First(&user).Error; err != nil {
+			return nil, err
+		}
+
+		assigned, err := UserRoles(a.db, &user)
+		if err != nil {
+			return nil, err
+		}
+		return &Grants{Assigned: assigned}, nil
+	})
+}
+
+// OrganizationGrants returns the roles and permissions of a user working in an organization:
+// their own roles plus the role of their membership. It returns gorm.ErrRecordNotFound when
+// the user is not a member.
+func (a *AccessControl) OrganizationGrants(userID, organizationID uint) (*Grants, error) {
+	return a.cached(grantsKey{UserID: userID, OrganizationID: organizationID}, func() (*Grants, error) {
+		var membership models.Membership
+		if err := a.db.Where("user_id = ? AND organization_id = ?", userID, organizationID).First(&membership).Error; err != nil {
+			return nil, err
+		}
+
+		own, err := a.Grants(userID)
+		if err != nil {
+			return nil, err
+		}
+
+		assigned := slices.Clone(own.Assigned)
+		if !slices.Contains(assigned, membership.Role) {
+			assigned = append(assigned, membership.Role)
+		}
+		return &Grants{Assigned: assigned, OrganizationRole: membership.Role}, nil
+	})
+}
+
+// RoleGrants returns the roles and permissions that holding the given roles confers,
+// such as when they are about to be assigned to someone
+func (a *AccessControl) RoleGrants(roles []string) (*Grants, error) {
+	grants := &Grants{Assigned: roles}
+	if err := a.resolve(grants); err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// cached returns cached grants, or resolves the roles and permissions of the assigned roles
+// returned by load and caches them
+func (a *AccessControl) cached(key grantsKey, load func() (*Grants, error)) (*Grants, error) {
+	a.mu.RLock()
+	cached, ok := a.grants[key]
+	a.mu.RUnlock()
+
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.grants, nil
+	}
+
+	grants, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.resolve(grants); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.grants[key] = cachedGrants{grants: grants, expiresAt: time.Now().Add(a.cacheTTL)}
+	a.mu.Unlock()
+
+	return grants, nil
+}
+
+// resolve fills in the roles implied by the assigned roles and the permissions they grant
+func (a *AccessControl) resolve(grants *Grants) error {
+	grants.Roles = a.hierarchy.Implied(grants.Assigned)
+
+	var roles []models.Role
+	if err := a.db.Preload("Permissions").Where("name IN ?", grants.Roles).Find(&roles).Error; err != nil {
+		return err
+	}
+
+	grants.Permissions = []string{}
+	for _, role := range roles {
+		// The admin role holds every permission, including ones added after it was set up
+		if role.Name == models.RoleAdmin {
+			return a.db.Model(&models.Permission{}).Order("name").Pluck("name", &grants.Permissions).Error
+		}
+		for _, permission := range role.Permissions {
+			if !slices.Contains(grants.Permissions, permission.Name) {
+				grants.Permissions = append(grants.Permissions, permission.Name)
+			}
+		}
+	}
+	slices.Sort(grants.Permissions)
+
+	return nil
+}
+
+// Invalidate drops the cached grants of a user after their roles or memberships changed
+func (a *AccessControl) Invalidate(userID uint) {
+	a.mu.Lock()
+	for key := range a.grants {
+		if key.UserID == userID {
+			delete(a.grants, key)
+		}
+	}
+	a.mu.Unlock()
+}
+
+// InvalidateAll drops every cached grant after a role's permissions changed
+func (a *AccessControl) InvalidateAll() {
+	a.mu.Lock()
+	a.grants = make(map[grantsKey]cachedGrants)
+	a.mu.Unlock()
+}
+
+// UserRoles returns the names of every role of a user: the primary role first,
+// followed by the additional roles assigned in user_roles
+func UserRoles(db *gorm.DB, user *models.User) ([]string, error) {
+	var assigned []string
+	if err := db.Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", user.ID).
+		Order("roles.name").
+		Pluck("roles.name", &assigned).Error; err != nil {
+		return nil, err
+	}
+
+	roles := []string{user.Role}
+	for _, role := range assigned {
+		if role != user.Role {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
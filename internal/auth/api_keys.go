@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefix marks API keys so they are easy to recognize, e.g. by secret scanners
+	apiKeyPrefix = "gb_"
+
+	// apiKeyLastUsedInterval limits how often last-used tracking writes to the database per key
+	apiKeyLastUsedInterval = time.Minute
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired API keys and keys of inactive users
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyStore authenticates personal access tokens against the api_keys table
+type APIKeyStore struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyStore creates an API key store
+func NewAPIKeyStore(db *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+// GenerateAPIKey returns a new API key of the form gb_<prefix>_<secret> together with its lookup prefix
+func GenerateAPIKey() (key, prefix string, err error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix = hex.EncodeToString(b)
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + prefix + "_" + secret, prefix, nil
+}
+
+// Authenticate looks up an API key by its prefix, verifies it and returns claims for its user
+// limited to the key's scopes. Successful uses are recorded as the key's last use.
+func (s *APIKeyStore) Authenticate(key, ip string) (*models.JWTCustomClaims, error) {
+	rest, ok := strings.CutPrefix(key, apiKeyPrefix)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	if err := s.db.Where("prefix = ?", prefix).First(&apiKey).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(key)), []byte(apiKey.KeyHash)) != 1 || !apiKey.Active() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ? AND active = ?", apiKey.UserID, true).First(&user).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	s.recordUse(&apiKey, ip)
+
+	return &models.JWTCustomClaims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Role:     user.Role,
+		Scope:    apiKey.Scopes,
+		APIKeyID: apiKey.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.FormatUint(uint64(user.ID), 10),
+		},
+	}, nil
+}
+
+// recordUse updates the key's last use, at most once per apiKeyLastUsedInterval.
+// Failures are only logged, since they must not fail the request.
+func (s *APIKeyStore) recordUse(apiKey *models.APIKey, ip string) {
+	now := time.Now()
+	err := s.db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-apiKeyLastUsedInterval)).
+		Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": ip}).Error
+	if err != nil {
+		log.Println("Warning: failed to record API key use:", err)
+	}
+}
@@ -0,0 +1,419 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// keyRotationLockID is the Postgres advisory lock taken while rotating keys,
+// so that only one instance creates the next key
+const keyRotationLockID = 7243001
+
+// keySyncInterval is how often keys are reloaded to pick up rotations by other instances
+const keySyncInterval = time.Minute
+
+// keyReloadInterval limits how often keys are reloaded for a token with an unknown kid
+const keyReloadInterval = 10 * time.Second
+
+// signingKey is a loaded key pair ready for signing and verification.
+// Retired keys only verify, so their private half is never decrypted.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+	retired bool
+}
+
+// KeyManager signs and verifies access tokens.
+// With JWT_ALGORITHM=HS256 it uses the shared JWT secret. With RS256, ES256 or
+// EdDSA it keeps key pairs in the signing_keys table, identified by kid, rotates
+// them on a schedule and keeps retired keys verifiable for a grace period.
+type KeyManager struct {
+	db     *gorm.DB
+	config *config.Config
+	cipher *Cipher
+
+	mu       sync.RWMutex
+	active   *signingKey
+	keys     map[string]*signingKey
+	loadedAt time.Time
+
+	// reloadMu serializes reloads for unknown kids
+	reloadMu sync.Mutex
+}
+
+// NewKeyManager creates a key manager and, for asymmetric algorithms, loads or creates the signing keys
+func NewKeyManager(db *gorm.DB, cfg *config.Config, cipher *Cipher) (*KeyManager, error) {
+	m := &KeyManager{
+		db:     db,
+		config: cfg,
+		cipher: cipher,
+		keys:   make(map[string]*signingKey),
+	}
+
+	if !m.asymmetric() {
+		if signingMethod(cfg.JWTAlgorithm) == nil {
+			return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.JWTAlgorithm)
+		}
+		return m, nil
+	}
+
+	if err := m.rotateIfDue(); err != nil {
+		return nil, err
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Start rotates keys on schedule and reloads them periodically in the background
+func (m *KeyManager) Start() {
+	if !m.asymmetric() {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(keySyncInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := m.rotateIfDue(); err != nil {
+				log.Println("Warning: failed to rotate signing keys:", err)
+			}
+			if err := m.load(); err != nil {
+				log.Println("Warning: failed to load signing keys:", err)
+			}
+		}
+	}()
+}
+
+// Sign signs claims with the active key, setting the kid header for asymmetric keys
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	if !m.asymmetric() {
+		token := jwt.NewWithClaims(signingMethod(m.config.JWTAlgorithm), claims)
+		return token.SignedString([]byte(m.config.JWTSecret))
+	}
+
+	m.mu.RLock()
+	active := m.active
+	m.mu.RUnlock()
+
+	if active == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = active.kid
+	return token.SignedString(active.private)
+}
+
+// Keyfunc resolves the verification key for a token, matching its kid and algorithm
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if !m.asymmetric() {
+		if token.Method.Alg() != m.config.JWTAlgorithm {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(m.config.JWTSecret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := m.verificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.public, nil
+}
+
+// verificationKey returns the key with the given kid, reloading the keys when the kid
+// is unknown so that a key just created by another instance is picked up before the next sync
+func (m *KeyManager) verificationKey(kid string) (*signingKey, error) {
+	if key, ok := m.lookupKey(kid); ok {
+		return key, nil
+	}
+	if kid == "" {
+		return nil, errors.New("unknown signing key")
+	}
+
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	// Another request may have reloaded while this one waited
+	if key, ok := m.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	m.mu.RLock()
+	loadedAt := m.loadedAt
+	m.mu.RUnlock()
+
+	if time.Since(loadedAt) < keyReloadInterval {
+		return nil, errors.New("unknown signing key")
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	if key, ok := m.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// lookupKey finds a loaded key by kid
+func (m *KeyManager) lookupKey(kid string) (*signingKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.keys[kid]
+	return key, ok
+}
+
+// ValidMethods returns the signing algorithms accepted when parsing tokens
+func (m *KeyManager) ValidMethods() []string {
+	return []string{m.config.JWTAlgorithm}
+}
+
+// JWKS returns the public keys that currently verify tokens
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(m.keys))}
+	for _, key := range m.keys {
+		jwk, err := NewJWK(key.kid, key.method.Alg(), key.public)
+		if err != nil {
+			log.Printf("Warning: failed to encode signing key %s: %v", key.kid, err)
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// asymmetric reports whether tokens are signed with key pairs rather than the shared secret
+func (m *KeyManager) asymmetric() bool {
+	return m.config.JWTAlgorithm != jwt.SigningMethodHS256.Alg()
+}
+
+// load reads all keys that still verify tokens and picks the newest unretired one for signing
+func (m *KeyManager) load() error {
+	var records []models.SigningKey
+	if err := m.db.Where("algorithm = ? AND (expires_at IS NULL OR expires_at > ?)", m.config.JWTAlgorithm, time.Now()).
+		Order("created_at DESC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(records))
+	var active *signingKey
+	for _, record := range records {
+		key, err := m.decode(record)
+		if err != nil {
+			log.Printf("Warning: skipping signing key %s: %v", record.KID, err)
+			continue
+		}
+		keys[key.kid] = key
+		if active == nil && !key.retired {
+			active = key
+		}
+	}
+
+	if active == nil {
+		return errors.New("no active signing key")
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.active = active
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// rotateIfDue creates a new signing key when none exists or the active one is older than
+// the rotation interval, and retires the previous keys with a verification grace period
+func (m *KeyManager) rotateIfDue() error {
+	return m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", keyRotationLockID).Error; err != nil {
+			return err
+		}
+
+		var current []models.SigningKey
+		if err := tx.Where("algorithm = ? AND retired_at IS NULL", m.config.JWTAlgorithm).
+			Order("created_at DESC").Limit(1).Find(&current).Error; err != nil {
+			return err
+		}
+
+		interval := m.config.JWTKeyRotationInterval
+		if len(current) > 0 && (interval <= 0 || time.Since(current[0].CreatedAt) < interval) {
+			return nil
+		}
+
+		record, err := m.generate()
+		if err != nil {
+			return err
+		}
+
+		// Retired keys must outlive every token they signed
+		grace := m.config.JWTKeyGracePeriod
+		if grace < m.config.AccessTokenTTL {
+			grace = m.config.AccessTokenTTL
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.SigningKey{}).
+			Where("retired_at IS NULL").
+			Updates(map[string]interface{}{"retired_at": now, "expires_at": now.Add(grace)}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+
+		log.Printf("Rotated JWT signing key, new kid %s (%s)", record.KID, record.Algorithm)
+		return nil
+	})
+}
+
+// generate creates a new key pair for the configured algorithm
+func (m *KeyManager) generate() (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch m.config.JWTAlgorithm {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256.Alg():
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", m.config.JWTAlgorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := m.cipher.Encrypt(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KID:        uuid.NewString(),
+		Algorithm:  m.config.JWTAlgorithm,
+		PrivateKey: encrypted,
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// decode parses a stored key pair; the private key is only decrypted for keys that still sign
+func (m *KeyManager) decode(record models.SigningKey) (*signingKey, error) {
+	method := signingMethod(record.Algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", record.Algorithm)
+	}
+
+	block, _ := pem.Decode([]byte(record.PublicKey))
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		kid:     record.KID,
+		method:  method,
+		public:  public,
+		retired: record.RetiredAt != nil,
+	}
+	if key.retired {
+		return key, nil
+	}
+
+	privatePEM, err := m.cipher.Decrypt(record.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ = pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("invalid private key PEM")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+
+	// A private key that doesn't match the stored public key would sign unverifiable tokens
+	if matcher, ok := private.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !matcher.Equal(public) {
+		return nil, errors.New("private key does not match public key")
+	}
+
+	key.private = private
+	return key, nil
+}
+
+// signingMethod maps a configured algorithm name to its JWT signing method
+func signingMethod(alg string) jwt.SigningMethod {
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		return jwt.SigningMethodHS256
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256
+	case jwt.SigningMethodES256.Alg():
+		return jwt.SigningMethodES256
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA
+	default:
+		return nil
+	}
+}
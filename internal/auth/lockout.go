@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lockout error codes returned in API error bodies
+const (
+	LockoutCodeLocked    = "account_locked"
+	LockoutCodeThrottled = "login_throttled"
+)
+
+// LockoutError describes why an account cannot attempt to log in right now
+type LockoutError struct {
+	Code        string
+	RetryAfter  time.Duration
+	LockedUntil *time.Time
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", e.Code, e.RetryAfter)
+}
+
+// LoginGuard enforces per-account failed login limits.
+// Each failure doubles the delay before the next attempt is accepted, and reaching
+// the threshold locks the account for a fixed window. While the counter stays at
+// or above the threshold, every further failure locks the account again.
+type LoginGuard struct {
+	db     *gorm.DB
+	config *config.Config
+}
+
+// NewLoginGuard creates a login guard
+func NewLoginGuard(db *gorm.DB, cfg *config.Config) *LoginGuard {
+	return &LoginGuard{db: db, config: cfg}
+}
+
+// Check returns a LockoutError if the user is locked out or still within the backoff delay
+func (g *LoginGuard) Check(user *models.User) *LockoutError {
+	return g.check(user.FailedLoginAttempts, user.LastFailedLoginAt, user.LockedUntil)
+}
+
+// CheckEmail is Check for a login email that matches no active account
+func (g *LoginGuard) CheckEmail(email string) (*LockoutError, error) {
+	var attempt models.LoginAttempt
+	err := g.db.Where("email_hash = ?", loginEmailHash(email)).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.check(attempt.FailedLoginAttempts, attempt.LastFailedLoginAt, attempt.LockedUntil), nil
+}
+
+func (g *LoginGuard) check(attempts int, lastFailedAt, lockedUntil *time.Time) *LockoutError {
+	now := time.Now()
+
+	if lockedUntil != nil && now.Before(*lockedUntil) {
+		return &LockoutError{
+			Code:        LockoutCodeLocked,
+			RetryAfter:  lockedUntil.Sub(now),
+			LockedUntil: lockedUntil,
+		}
+	}
+
+	if attempts > 0 && lastFailedAt != nil {
+		allowedAt := lastFailedAt.Add(g.backoff(attempts))
+		if now.Before(allowedAt) {
+			return &LockoutError{
+				Code:       LockoutCodeThrottled,
+				RetryAfter: allowedAt.Sub(now),
+			}
+		}
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed attempt and returns a LockoutError if the account is now locked.
+// The counter is incremented and the lock decided in one statement, so concurrent failures
+// cannot all read the same count and slip past the threshold.
+func (g *LoginGuard) RecordFailure(user *models.User) (*LockoutError, error) {
+	now := time.Now()
+	until := now.Add(g.config.LockoutDuration)
+
+	updates := map[string]interface{}{
+		"failed_login_attempts": gorm.Expr("failed_login_attempts + 1"),
+		"last_failed_login_at":  now,
+	}
+	if g.config.LockoutThreshold > 0 {
+		updates["locked_until"] = gorm.Expr("CASE WHEN failed_login_attempts + 1 >= ? THEN ? ELSE locked_until END", g.config.LockoutThreshold, until)
+	}
+
+	var updated models.User
+	if err := g.db.Model(&updated).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_login_attempts"}, {Name: "locked_until"}}}).
+		Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	user.FailedLoginAttempts = updated.FailedLoginAttempts
+	user.LastFailedLoginAt = &now
+	user.LockedUntil = updated.LockedUntil
+
+	lockout := g.lockout(updated.FailedLoginAttempts, updated.LockedUntil)
+	if lockout != nil {
+		log.Printf("Account %d locked until %s after %d failed login attempts", user.ID, until.Format(time.RFC3339), updated.FailedLoginAttempts)
+	}
+	return lockout, nil
+}
+
+// RecordEmailFailure is RecordFailure for a login email that matches no active account.
+// Unknown emails are throttled and locked exactly like accounts, so the responses
+// don't reveal which emails are registered.
+func (g *LoginGuard) RecordEmailFailure(email string) (*LockoutError, error) {
+	now := time.Now()
+	until := now.Add(g.config.LockoutDuration)
+
+	attempt := models.LoginAttempt{
+		EmailHash:           loginEmailHash(email),
+		FailedLoginAttempts: 1,
+		LastFailedLoginAt:   &now,
+	}
+	updates := map[string]interface{}{
+		"failed_login_attempts": gorm.Expr("login_attempts.failed_login_attempts + 1"),
+		"last_failed_login_at":  now,
+		"updated_at":            now,
+	}
+	if g.config.LockoutThreshold > 0 {
+		if g.config.LockoutThreshold <= 1 {
+			attempt.LockedUntil = &until
+		}
+		updates["locked_until"] = gorm.Expr("CASE WHEN login_attempts.failed_login_attempts + 1 >= ? THEN ? ELSE login_attempts.locked_until END", g.config.LockoutThreshold, until)
+	}
+
+	if err := g.db.Clauses(
+		clause.OnConflict{Columns: []clause.Column{{Name: "email_hash"}}, DoUpdates: clause.Assignments(updates)},
+		clause.Returning{Columns: []clause.Column{{Name: "failed_login_attempts"}, {Name: "locked_until"}}},
+	).Create(&attempt).Error; err != nil {
+		return nil, err
+	}
+
+	return g.lockout(attempt.FailedLoginAttempts, attempt.LockedUntil), nil
+}
+
+// lockout returns the LockoutError for a counter that was just incremented, if it reached the threshold
+func (g *LoginGuard) lockout(attempts int, lockedUntil *time.Time) *LockoutError {
+	if g.config.LockoutThreshold <= 0 || attempts < g.config.LockoutThreshold {
+		return nil
+	}
+	return &LockoutError{
+		Code:        LockoutCodeLocked,
+		RetryAfter:  g.config.LockoutDuration,
+		LockedUntil: lockedUntil,
+	}
+}
+
+// RecordSuccess clears the failed attempt counter after a successful login
+func (g *LoginGuard) RecordSuccess(user *models.User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return UnlockAccount(g.db, user.ID)
+}
+
+// backoff returns the delay required after the given number of consecutive failures
+func (g *LoginGuard) backoff(attempts int) time.Duration {
+	delay := g.config.LoginBackoffBase
+	for i := 1; i < attempts && delay < g.config.LoginBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > g.config.LoginBackoffMax {
+		delay = g.config.LoginBackoffMax
+	}
+	return delay
+}
+
+// UnlockAccount resets the failed login counter and lifts any lockout
+func UnlockAccount(db *gorm.DB, userID uint) error {
+	return db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"last_failed_login_at":  nil,
+		"locked_until":          nil,
+	}).Error
+}
+
+// loginEmailHash normalizes a login email and hashes it, so login_attempts never stores addresses
+func loginEmailHash(email string) string {
+	return utils.HashToken(strings.ToLower(strings.TrimSpace(email)))
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"golang-base/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationList tracks revoked access tokens and per-user token versions.
+// Revoked token IDs are mirrored in memory and re-synced from the database
+// periodically, and token versions are cached for a short time, so the
+// authentication middleware doesn't have to query the database on every request.
+type RevocationList struct {
+	db       *gorm.DB
+	cacheTTL time.Duration
+
+	mu       sync.RWMutex
+	revoked  map[string]time.Time
+	versions map[uint]cachedVersion
+}
+
+type cachedVersion struct {
+	version   int
+	expiresAt time.Time
+}
+
+// NewRevocationList creates a revocation list backed by the revoked_tokens table
+func NewRevocationList(db *gorm.DB, cacheTTL time.Duration) *RevocationList {
+	return &RevocationList{
+		db:       db,
+		cacheTTL: cacheTTL,
+		revoked:  make(map[string]time.Time),
+		versions: make(map[uint]cachedVersion),
+	}
+}
+
+// Start loads the current revocations and keeps them in sync in the background
+func (r *RevocationList) Start() {
+	if err := r.sync(); err != nil {
+		log.Println("Warning: failed to load revoked tokens:", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.cacheTTL)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := r.sync(); err != nil {
+				log.Println("Warning: failed to sync revoked tokens:", err)
+			}
+		}
+	}()
+}
+
+// sync prunes expired revocations and reloads the remaining ones from the database
+func (r *RevocationList) sync() error {
+	now := time.Now()
+
+	if err := r.db.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+
+	var tokens []models.RevokedToken
+	if err := r.db.Where("expires_at >= ?", now).Find(&tokens).Error; err != nil {
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(tokens))
+	for _, token := range tokens {
+		revoked[token.JTI] = token.ExpiresAt
+	}
+
+	r.mu.Lock()
+	r.revoked = revoked
+	for userID, cached := range r.versions {
+		if now.After(cached.expiresAt) {
+			delete(r.versions, userID)
+		}
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// ConsumeToken revokes a single-use token, such as an MFA challenge, and reports whether
+// this call revoked it. It returns false when the token was already used, so of two
+// concurrent requests presenting the same token only one succeeds.
+func (r *RevocationList) ConsumeToken(jti string, userID uint, expiresAt time.Time) (bool, error) {
+	token := models.RevokedToken{
+		JTI:       jti,
+		ExpiresAt: expiresAt,
+	}
+	if userID != 0 {
+		token.UserID = &userID
+	}
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&token)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	r.mu.Lock()
+	r.revoked[jti] = expiresAt
+	r.mu.Unlock()
+
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeToken revokes a single access token until it would have expired anyway.
+// userID is 0 for tokens that were not issued to a user.
+func (r *RevocationList) RevokeToken(jti string, userID uint, expiresAt time.Time) error {
+	_, err := r.ConsumeToken(jti, userID, expiresAt)
+	return err
+}
+
+// IsTokenRevoked reports whether an access token has been revoked, either individually,
+// with its session, or because its user's (or impersonating admin's) token version was
+// bumped or the user was deactivated
+func (r *RevocationList) IsTokenRevoked(claims *models.JWTCustomClaims) bool {
+	if r.IsRevoked(claims.ID) {
+		return true
+	}
+
+	if claims.SessionID != "" && r.IsRevoked(sessionRevocationID(claims.SessionID)) {
+		return true
+	}
+
+	// Client credentials tokens have no user whose token version could change
+	if claims.UserID == 0 {
+		return false
+	}
+
+	currentVersion, err := r.TokenVersion(claims.UserID)
+	if err != nil || claims.TokenVersion < currentVersion {
+		return true
+	}
+
+	// An impersonation ends as soon as the admin behind it is logged out everywhere or deactivated
+	if claims.Actor != nil {
+		actorVersion, err := r.TokenVersion(claims.Actor.UserID)
+		return err != nil || claims.Actor.TokenVersion < actorVersion
+	}
+
+	return false
+}
+
+// IsRevoked reports whether the access token with the given ID has been revoked
+func (r *RevocationList) IsRevoked(jti string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.revoked[jti]
+	return ok
+}
+
+// EndSession signs a session out immediately: its refresh tokens are revoked, and so are
+// its access tokens until accessExpiry, after which none issued before now can be valid
+func (r *RevocationList) EndSession(db *gorm.DB, userID uint, sessionID string, accessExpiry time.Time) error {
+	if err := RevokeSession(db, sessionID); err != nil {
+		return err
+	}
+	return r.RevokeToken(sessionRevocationID(sessionID), userID, accessExpiry)
+}
+
+// sessionRevocationID is the revoked_tokens key under which a whole session is revoked.
+// It cannot collide with access token IDs, which are plain UUIDs.
+func sessionRevocationID(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// RevokeAllForUser invalidates every access and refresh token issued to a user
+// by bumping the user's token version and revoking all of their refresh tokens.
+func (r *RevocationList) RevokeAllForUser(db *gorm.DB, userID uint) error {
+	return r.revokeUserTokens(db, userID, "")
+}
+
+// RevokeOtherSessions invalidates every access token of a user and the refresh tokens
+// of all sessions except the given one. The caller is expected to hand the kept
+// session a new access token, since its current one carries the old token version.
+func (r *RevocationList) RevokeOtherSessions(db *gorm.DB, userID uint, keepSessionID string) error {
+	return r.revokeUserTokens(db, userID, keepSessionID)
+}
+
+// revokeUserTokens bumps the token version of a user and revokes their refresh tokens,
+// optionally keeping those of one session
+func (r *RevocationList) revokeUserTokens(db *gorm.DB, userID uint, keepSessionID string) error {
+	var version int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+
+		query := tx.Model(&models.RefreshToken{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+		if keepSessionID != "" {
+			query = query.Where("family_id <> ?", keepSessionID)
+		}
+		if err := query.Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		sessions := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+		if keepSessionID != "" {
+			sessions = sessions.Where("id <> ?", keepSessionID)
+		}
+		if err := sessions.Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", userID).Pluck("token_version", &version).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.versions[userID] = cachedVersion{version: version, expiresAt: time.Now().Add(r.cacheTTL)}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// TokenVersion returns the current token version of a user.
+// Access tokens carrying an older version are no longer accepted.
+func (r *RevocationList) TokenVersion(userID uint) (int, error) {
+	r.mu.RLock()
+	cached, ok := r.versions[userID]
+	r.mu.RUnlock()
+
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.version, nil
+	}
+
+	var versions []int
+	if err := r.db.Model(&models.User{}).Where("id = ? AND active = ?", userID, true).Pluck("token_version", &versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	r.mu.Lock()
+	r.versions[userID] = cachedVersion{version: versions[0], expiresAt: time.Now().Add(r.cacheTTL)}
+	r.mu.Unlock()
+
+	return versions[0], nil
+}
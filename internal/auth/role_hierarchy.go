@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RoleHierarchy records which roles include others. A user holding a role also holds
+// every role below it, along with those roles' permissions.
+type RoleHierarchy map[string][]string
+
+// ParseRoleHierarchy parses a comma-separated list of chains such as
+// "admin>moderator>user,admin>support", where each role includes the roles to its right.
+// Cycles are rejected.
+func ParseRoleHierarchy(spec string) (RoleHierarchy, error) {
+	hierarchy := RoleHierarchy{}
+
+	for _, chain := range strings.Split(spec, ",") {
+		chain = strings.TrimSpace(chain)
+		if chain == "" {
+			continue
+		}
+
+		roles := strings.Split(chain, ">")
+		for i := range roles {
+			roles[i] = strings.TrimSpace(roles[i])
+			if roles[i] == "" {
+				return nil, fmt.Errorf("empty role in role hierarchy %q", chain)
+			}
+		}
+
+		for i := 0; i+1 < len(roles); i++ {
+			if !slices.Contains(hierarchy[roles[i]], roles[i+1]) {
+				hierarchy[roles[i]] = append(hierarchy[roles[i]], roles[i+1])
+			}
+		}
+	}
+
+	for role, included := range hierarchy {
+		if slices.Contains(hierarchy.Implied(included), role) {
+			return nil, fmt.Errorf("role hierarchy contains a cycle through %q", role)
+		}
+	}
+
+	return hierarchy, nil
+}
+
+// Implied returns the given roles followed by every role they include, without duplicates
+func (h RoleHierarchy) Implied(roles []string) []string {
+	implied := make([]string, 0, len(roles))
+	queue := slices.Clone(roles)
+
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+
+		if slices.Contains(implied, role) {
+			continue
+		}
+		implied = append(implied, role)
+		queue = append(queue, h[role]...)
+	}
+
+	return implied
+}
@@ -0,0 +1,396 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+var ErrRefreshTokenReused = errors.New("refresh token already rotated")
+
+// TokenPair holds the tokens returned to a client after a successful authentication
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+	SessionID    string
+	CSRFToken    string
+}
+
+// TokenIssuer signs access tokens and manages the refresh tokens that accompany them
+type TokenIssuer struct {
+	config *config.Config
+	keys   *KeyManager
+}
+
+// NewTokenIssuer creates a token issuer that signs access tokens with the given keys
+func NewTokenIssuer(cfg *config.Config, keys *KeyManager) *TokenIssuer {
+	return &TokenIssuer{config: cfg, keys: keys}
+}
+
+// GenerateJWT generates an access token for the user within the given session.
+// The session ID is the family ID shared by the session's refresh tokens; organizationID
+// is the organization selected for the session, or zero.
+func (i *TokenIssuer) GenerateJWT(user *models.User, sessionID string, organizationID uint) (string, error) {
+	claims := i.newClaims(strconv.FormatUint(uint64(user.ID), 10))
+	claims.UserID = user.ID
+	claims.Email = user.Email
+	claims.Role = user.Role
+	claims.SessionID = sessionID
+	claims.TokenVersion = user.TokenVersion
+	claims.OrganizationID = organizationID
+
+	return i.keys.Sign(claims)
+}
+
+// GenerateImpersonationJWT generates a short-lived access token that lets an admin act as
+// another user. It belongs to no session, so it cannot be refreshed, and it names the admin
+// in the "act" claim. The claims are returned along with the token for auditing.
+func (i *TokenIssuer) GenerateImpersonationJWT(user, actor *models.User) (string, *models.JWTCustomClaims, error) {
+	claims := i.newClaims(strconv.FormatUint(uint64(user.ID), 10))
+	claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(i.config.ImpersonationTTL))
+	claims.UserID = user.ID
+	claims.Email = user.Email
+	claims.Role = user.Role
+	claims.TokenVersion = user.TokenVersion
+	claims.Actor = &models.ActorClaim{
+		Subject:      strconv.FormatUint(uint64(actor.ID), 10),
+		UserID:       actor.ID,
+		Email:        actor.Email,
+		TokenVersion: actor.TokenVersion,
+	}
+
+	token, err := i.keys.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// GenerateOAuthJWT generates an access token for an OAuth client limited to the granted scope.
+// With a user it acts on the user's behalf (authorization code grant); without one the
+// client acts on its own behalf (client credentials grant). The claims are returned along
+// with the token so that it can be revoked later.
+func (i *TokenIssuer) GenerateOAuthJWT(user *models.User, clientID, scope string) (string, *models.JWTCustomClaims, error) {
+	claims := i.newClaims(clientID)
+	if user != nil {
+		claims.Subject = strconv.FormatUint(uint64(user.ID), 10)
+		claims.UserID = user.ID
+		claims.Email = user.Email
+		claims.Role = user.Role
+		claims.TokenVersion = user.TokenVersion
+	}
+	claims.ClientID = clientID
+	claims.Scope = scope
+
+	token, err := i.keys.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// newClaims builds the registered claims shared by every access token
+func (i *TokenIssuer) newClaims(subject string) *models.JWTCustomClaims {
+	now := time.Now()
+	return &models.JWTCustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.config.JWTIssuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{i.config.JWTAudience},
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.config.AccessTokenTTL)),
+		},
+	}
+}
+
+// ParseJWT validates an access token's signature, issuer, audience and validity window
+// and returns its claims. Revocation is checked separately by the caller.
+func (i *TokenIssuer) ParseJWT(tokenString string) (*models.JWTCustomClaims, error) {
+	claims := &models.JWTCustomClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, i.keys.Keyfunc,
+		jwt.WithValidMethods(i.keys.ValidMethods()),
+		jwt.WithIssuer(i.config.JWTIssuer),
+		jwt.WithAudience(i.config.JWTAudience),
+		jwt.WithLeeway(i.config.JWTLeeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	// The library only checks nbf when present, so require it along with jti and a matching subject
+	if claims.NotBefore == nil || claims.ID == "" || claims.Subject == "" || claims.Subject != tokenSubject(claims) {
+		return nil, errors.New("invalid token claims")
+	}
+
+	return claims, nil
+}
+
+// tokenSubject returns the subject a token must carry: the user ID, or the client ID for client credentials tokens
+func tokenSubject(claims *models.JWTCustomClaims) string {
+	if claims.UserID == 0 {
+		return claims.ClientID
+	}
+	return strconv.FormatUint(uint64(claims.UserID), 10)
+}
+
+// IssueTokenPair signs an access token and stores a new refresh token in the given session
+func (i *TokenIssuer) IssueTokenPair(db *gorm.DB, user *models.User, sessionID string) (*TokenPair, error) {
+	var organizationIDs []uint
+	if err := db.Model(&models.Session{}).Where("id = ? AND organization_id IS NOT NULL", sessionID).
+		Pluck("organization_id", &organizationIDs).Error; err != nil {
+		return nil, err
+	}
+	var organizationID uint
+	if len(organizationIDs) > 0 {
+		organizationID = organizationIDs[0]
+	}
+
+	accessToken, err := i.GenerateJWT(user, sessionID, organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(i.config.SessionTimeout),
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(i.config.AccessTokenTTL.Seconds()),
+		SessionID:    sessionID,
+		CSRFToken:    i.CSRFToken(sessionID),
+	}, nil
+}
+
+// StartSession records a new login from the given client and issues its first token pair.
+// Users who belong to a single organization start out working in it.
+func (i *TokenIssuer) StartSession(db *gorm.DB, user *models.User, ipAddress, userAgent string) (*TokenPair, error) {
+	now := time.Now()
+	session := models.Session{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(i.config.SessionTimeout),
+	}
+
+	var organizationIDs []uint
+	if err := db.Model(&models.Membership{}).Where("user_id = ?", user.ID).Pluck("organization_id", &organizationIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(organizationIDs) == 1 {
+		session.OrganizationID = &organizationIDs[0]
+	}
+
+	var tokens *TokenPair
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		tokens, err = i.IssueTokenPair(tx, user, session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token pair in the same session.
+// The presented token can only be used once; presenting an already rotated token
+// revokes every token in its family and returns ErrRefreshTokenReused.
+// The session is marked as seen from the given client.
+func (i *TokenIssuer) RotateRefreshToken(db *gorm.DB, refreshToken, ipAddress, userAgent string) (*TokenPair, *models.User, error) {
+	var stored models.RefreshToken
+	if err := db.Where("token_hash = ?", utils.HashToken(refreshToken)).First(&stored).Error; err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if stored.RotatedAt != nil {
+		return nil, nil, revokeReusedFamily(db, stored.FamilyID)
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	var user models.User
+	if err := db.Where("id = ? AND active = ?", stored.UserID, true).First(&user).Error; err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	// Rotate the token; the conditional update guards against concurrent reuse
+	var tokens *TokenPair
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", stored.ID).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		tokens, err = i.IssueTokenPair(tx, &user, stored.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&models.Session{}).
+			Where("id = ?", stored.FamilyID).
+			Updates(map[string]interface{}{
+				"ip_address":   ipAddress,
+				"user_agent":   userAgent,
+				"last_seen_at": now,
+				"expires_at":   now.Add(i.config.SessionTimeout),
+			}).Error
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		return nil, nil, revokeReusedFamily(db, stored.FamilyID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokens, &user, nil
+}
+
+// revokeReusedFamily revokes a token family after one of its rotated tokens was presented again
+func revokeReusedFamily(db *gorm.DB, familyID string) error {
+	if err := RevokeSession(db, familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+const csrfPurpose = "csrf"
+
+// CSRFToken derives the anti-CSRF token for a session.
+// It is bound to the session ID, so it stays valid across refresh token rotations
+// and cannot be reused with another user's session cookie.
+func (i *TokenIssuer) CSRFToken(sessionID string) string {
+	mac := hmac.New(sha256.New, i.purposeKey(csrfPurpose))
+	mac.Write([]byte(sessionID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCSRFToken reports whether token is the anti-CSRF token of the session
+func (i *TokenIssuer) VerifyCSRFToken(sessionID, token string) bool {
+	if sessionID == "" || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(i.CSRFToken(sessionID)), []byte(token))
+}
+
+// RevokeSession ends a session by revoking every refresh token that descends from the same login
+func RevokeSession(db *gorm.DB, sessionID string) error {
+	now := time.Now()
+	if err := db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	return db.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", now).Error
+}
+
+const mfaChallengePurpose = "mfa-challenge"
+
+// MFAChallenge identifies a user who passed the password check but still has to present a second factor.
+// Enrollment is set when the user had no second factor yet and must enroll one to finish logging in.
+type MFAChallenge struct {
+	UserID     uint
+	ID         string
+	ExpiresAt  time.Time
+	Enrollment bool
+}
+
+// GenerateMFAChallenge signs a short-lived token proving that the user passed the first login step.
+// It is signed with a key derived for this purpose only, so it can never be used as an access token.
+func (i *TokenIssuer) GenerateMFAChallenge(user *models.User, enrollment bool) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"jti":     uuid.NewString(),
+		"exp":     time.Now().Add(i.config.MFAChallengeTTL).Unix(),
+		"iat":     time.Now().Unix(),
+		"enroll":  enrollment,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(i.purposeKey(mfaChallengePurpose))
+}
+
+// ParseMFAChallenge validates a token created by GenerateMFAChallenge
+func (i *TokenIssuer) ParseMFAChallenge(tokenString string) (*MFAChallenge, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return i.purposeKey(mfaChallengePurpose), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid MFA challenge")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid MFA challenge claims")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	jti, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if !ok || jti == "" || err != nil {
+		return nil, errors.New("invalid MFA challenge claims")
+	}
+
+	enrollment, _ := claims["enroll"].(bool)
+
+	return &MFAChallenge{UserID: uint(userID), ID: jti, ExpiresAt: expiresAt.Time, Enrollment: enrollment}, nil
+}
+
+// purposeKey derives a signing key for tokens that must not be interchangeable with access tokens
+func (i *TokenIssuer) purposeKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(i.config.JWTSecret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
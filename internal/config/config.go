@@ -1,8 +1,10 @@
 package config
 
 import (
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,7 +17,70 @@ type Config struct {
 	RateLimit       int
 	RateLimitWindow time.Duration
 	SessionTimeout  time.Duration
+	AccessTokenTTL  time.Duration
 	BCryptCost      int
+	CookieSecure    bool
+
+	RevocationCacheTTL time.Duration
+
+	JWTIssuer              string
+	JWTAudience            string
+	JWTLeeway              time.Duration
+	JWTAlgorithm           string
+	JWTKeyRotationInterval time.Duration
+	JWTKeyGracePeriod      time.Duration
+
+	AppBaseURL               string
+	MailDriver               string
+	MailFrom                 string
+	MailDir                  string
+	MailSMTPHost             string
+	MailSMTPPort             int
+	MailSMTPUsername         string
+	MailSMTPPassword         string
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+	PasswordResetTTL         time.Duration
+	MagicLinkTTL             time.Duration
+	MagicLinkRoles           string
+	InvitationTTL            time.Duration
+
+	EncryptionKey   string
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	LoginBackoffBase time.Duration
+	LoginBackoffMax  time.Duration
+
+	OIDCProviderName string
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       string
+	OIDCAllowSignup  bool
+	OIDCLinkByEmail  bool
+
+	APIKeyDefaultTTL time.Duration
+	APIKeyMaxTTL     time.Duration
+
+	WebAuthnRPID         string
+	WebAuthnRPName       string
+	WebAuthnOrigins      string
+	WebAuthnChallengeTTL time.Duration
+
+	ImpersonationTTL time.Duration
+
+	RoleHierarchy string
+
+	PolicyFile        string
+	PolicyDecisionLog bool
+
+	TenantResolvers  string
+	TenantHeader     string
+	TenantBaseDomain string
 }
 
 // Load reads configuration from environment variables with sensible defaults
@@ -28,8 +93,136 @@ func Load() *Config {
 		RateLimit:       getEnvInt("RATE_LIMIT", 100),
 		RateLimitWindow: getEnvDuration("RATE_LIMIT_WINDOW", "1m"),
 		SessionTimeout:  getEnvDuration("SESSION_TIMEOUT", "24h"),
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", "15m"),
 		BCryptCost:      getEnvInt("BCRYPT_COST", 12),
+		CookieSecure:    getEnvBool("COOKIE_SECURE", true),
+
+		RevocationCacheTTL: getEnvDuration("REVOCATION_CACHE_TTL", "30s"),
+
+		JWTIssuer:              getEnv("JWT_ISSUER", "golang-base"),
+		JWTAudience:            getEnv("JWT_AUDIENCE", "golang-base-api"),
+		JWTLeeway:              getEnvDuration("JWT_LEEWAY", "30s"),
+		JWTAlgorithm:           getEnv("JWT_ALGORITHM", "HS256"),
+		JWTKeyRotationInterval: getEnvDuration("JWT_KEY_ROTATION_INTERVAL", "720h"),
+		JWTKeyGracePeriod:      getEnvDuration("JWT_KEY_GRACE_PERIOD", "24h"),
+
+		AppBaseURL:               getEnv("APP_BASE_URL", "http://localhost:3000"),
+		MailDriver:               getEnv("MAIL_DRIVER", "log"),
+		MailFrom:                 getEnv("MAIL_FROM", "GoFiber App <no-reply@localhost>"),
+		MailDir:                  getEnv("MAIL_DIR", "tmp/mail"),
+		MailSMTPHost:             getEnv("MAIL_SMTP_HOST", "localhost"),
+		MailSMTPPort:             getEnvInt("MAIL_SMTP_PORT", 1025),
+		MailSMTPUsername:         getEnv("MAIL_SMTP_USERNAME", ""),
+		MailSMTPPassword:         getEnv("MAIL_SMTP_PASSWORD", ""),
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", false),
+		EmailVerificationTTL:     getEnvDuration("EMAIL_VERIFICATION_TTL", "24h"),
+		PasswordResetTTL:         getEnvDuration("PASSWORD_RESET_TTL", "1h"),
+		MagicLinkTTL:             getEnvDuration("MAGIC_LINK_TTL", "15m"),
+		MagicLinkRoles:           getEnv("MAGIC_LINK_ROLES", "user"),
+		InvitationTTL:            getEnvDuration("INVITATION_TTL", "168h"),
+
+		EncryptionKey:   getEnv("ENCRYPTION_KEY", ""),
+		MFAIssuer:       getEnv("MFA_ISSUER", "GoFiber App"),
+		MFAChallengeTTL: getEnvDuration("MFA_CHALLENGE_TTL", "5m"),
+
+		LockoutThreshold: getEnvInt("LOCKOUT_THRESHOLD", 5),
+		LockoutDuration:  getEnvDuration("LOCKOUT_DURATION", "15m"),
+		LoginBackoffBase: getEnvDuration("LOGIN_BACKOFF_BASE", "1s"),
+		LoginBackoffMax:  getEnvDuration("LOGIN_BACKOFF_MAX", "30s"),
+
+		OIDCProviderName: getEnv("OIDC_PROVIDER_NAME", "Single Sign-On"),
+		OIDCIssuerURL:    getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:       getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCAllowSignup:  getEnvBool("OIDC_ALLOW_SIGNUP", true),
+		OIDCLinkByEmail:  getEnvBool("OIDC_LINK_BY_EMAIL", true),
+
+		APIKeyDefaultTTL: getEnvDuration("API_KEY_DEFAULT_TTL", "2160h"),
+		APIKeyMaxTTL:     getEnvDuration("API_KEY_MAX_TTL", "8760h"),
+
+		WebAuthnRPID:         getEnv("WEBAUTHN_RP_ID", ""),
+		WebAuthnRPName:       getEnv("WEBAUTHN_RP_NAME", "GoFiber App"),
+		WebAuthnOrigins:      getEnv("WEBAUTHN_ORIGINS", ""),
+		WebAuthnChallengeTTL: getEnvDuration("WEBAUTHN_CHALLENGE_TTL", "5m"),
+
+		ImpersonationTTL: getEnvDuration("IMPERSONATION_TTL", "15m"),
+
+		RoleHierarchy: getEnv("ROLE_HIERARCHY", "admin>user"),
+
+		PolicyFile:        getEnv("POLICY_FILE", ""),
+		PolicyDecisionLog: getEnvBool("POLICY_DECISION_LOG", true),
+
+		TenantResolvers:  getEnv("TENANT_RESOLVERS", "header,subdomain,claim"),
+		TenantHeader:     getEnv("TENANT_HEADER", "X-Organization"),
+		TenantBaseDomain: getEnv("TENANT_BASE_DOMAIN", ""),
+	}
+}
+
+// EncryptionSecret returns the key used to encrypt secrets at rest.
+// It falls back to the JWT secret so that development setups work without extra configuration.
+func (c *Config) EncryptionSecret() string {
+	if c.EncryptionKey != "" {
+		return c.EncryptionKey
 	}
+	return c.JWTSecret
+}
+
+// OIDCEnabled reports whether an OpenID Connect provider is configured for single sign-on
+func (c *Config) OIDCEnabled() bool {
+	return c.OIDCIssuerURL != "" && c.OIDCClientID != ""
+}
+
+// OIDCCallbackURL returns the redirect URI registered with the OpenID Connect provider.
+// It defaults to the callback route under APP_BASE_URL.
+func (c *Config) OIDCCallbackURL() string {
+	if c.OIDCRedirectURL != "" {
+		return c.OIDCRedirectURL
+	}
+	return strings.TrimRight(c.AppBaseURL, "/") + "/api/v1/auth/oidc/callback"
+}
+
+// MagicLinkAllowed reports whether users with a role may log in with an emailed link.
+// MAGIC_LINK_ROLES is a comma-separated list of roles; set it to "none" to disable magic links.
+func (c *Config) MagicLinkAllowed(role string) bool {
+	for _, allowed := range strings.Split(c.MagicLinkRoles, ",") {
+		if strings.TrimSpace(allowed) == role {
+			return true
+		}
+	}
+	return false
+}
+
+// WebAuthnRelyingPartyID returns the domain passkeys are scoped to.
+// It defaults to the host name of APP_BASE_URL.
+func (c *Config) WebAuthnRelyingPartyID() string {
+	if c.WebAuthnRPID != "" {
+		return c.WebAuthnRPID
+	}
+	if u, err := url.Parse(c.AppBaseURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// WebAuthnAllowedOrigins returns the origins passkey ceremonies may run on.
+// It defaults to the origin of APP_BASE_URL.
+func (c *Config) WebAuthnAllowedOrigins() []string {
+	if c.WebAuthnOrigins == "" {
+		if u, err := url.Parse(c.AppBaseURL); err == nil && u.Host != "" {
+			return []string{u.Scheme + "://" + u.Host}
+		}
+		return []string{strings.TrimRight(c.AppBaseURL, "/")}
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(c.WebAuthnOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimRight(origin, "/"))
+		}
+	}
+	return origins
 }
 
 // getEnv gets an environment variable or returns a default value
@@ -50,6 +243,16 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvBool gets an environment variable as bool or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
 // getEnvDuration gets an environment variable as duration or returns a default value
 func getEnvDuration(key string, defaultValue string) time.Duration {
 	value := getEnv(key, defaultValue)
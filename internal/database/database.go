@@ -1,6 +1,8 @@
 package database
 
 import (
+	"golang-base/internal/tenant"
+
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -16,5 +18,10 @@ func Connect(databaseURL string) (*gorm.DB, error) {
 		return nil, err
 	}
 
+	// Confine queries made within an organization to its rows
+	if err := db.Use(tenant.Plugin{}); err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
@@ -0,0 +1,143 @@
+// Package export writes tables as CSV, NDJSON or XLSX one row at a time, so that large
+// exports can be streamed without holding every row in memory.
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// ErrUnknownFormat is returned for formats other than csv, ndjson and xlsx
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer writes the rows of a table. Values may be strings, integers, booleans,
+// time.Time and *time.Time; nil pointers are written as empty cells. Close finishes
+// the file but does not close the underlying writer.
+type Writer interface {
+	WriteRow(values ...any) error
+	Close() error
+}
+
+// New returns a writer for the format that starts with the given columns: a CSV header
+// row, the keys of NDJSON objects, or the first row of the XLSX sheet
+func New(w io.Writer, format string, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		writer := &csvWriter{writer: csv.NewWriter(w)}
+		return writer, writer.writer.Write(columns)
+	case FormatNDJSON:
+		return &ndjsonWriter{writer: w, columns: columns}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w, columns)
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+}
+
+// ContentType returns the media type of files in the format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// csvWriter writes RFC 4180 CSV with times in RFC 3339
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvWriter) WriteRow(values ...any) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatText(value)
+		// Spreadsheets run text starting like a formula; a leading quote keeps it text
+		if _, ok := value.(string); ok && record[i] != "" && strings.ContainsRune("=+-@\t\r", rune(record[i][0])) {
+			record[i] = "'" + record[i]
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// ndjsonWriter writes every row as a JSON object keyed by column, in column order
+type ndjsonWriter struct {
+	writer  io.Writer
+	columns []string
+}
+
+func (w *ndjsonWriter) WriteRow(values ...any) error {
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	encoder.SetEscapeHTML(false)
+
+	line.WriteByte('{')
+	for i, value := range values {
+		if t, ok := value.(*time.Time); ok && t == nil {
+			value = nil
+		}
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		// Encode ends every value with a newline, which is dropped
+		if err := encoder.Encode(w.columns[i]); err != nil {
+			return err
+		}
+		line.Truncate(line.Len() - 1)
+		line.WriteByte(':')
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		line.Truncate(line.Len() - 1)
+	}
+	line.WriteString("}\n")
+
+	_, err := w.writer.Write(line.Bytes())
+	return err
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// formatText renders a value as cell text
+func formatText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type APIKeyHandler struct {
+	db       *gorm.DB
+	config   *config.Config
+	validate *validator.Validate
+}
+
+func NewAPIKeyHandler(db *gorm.DB, cfg *config.Config) *APIKeyHandler {
+	return &APIKeyHandler{
+		db:       db,
+		config:   cfg,
+		validate: validator.New(),
+	}
+}
+
+// GetAPIKeys lists the current user's API keys, including revoked and expired ones
+func (h *APIKeyHandler) GetAPIKeys(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var keys []models.APIKey
+	if err := h.db.Where("user_id = ?", currentUser.UserID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch API keys",
+		})
+	}
+
+	responses := make([]models.APIKeyResponse, len(keys))
+	for i := range keys {
+		responses[i] = keys[i].ToResponse()
+	}
+
+	return c.JSON(fiber.Map{
+		"api_keys": responses,
+	})
+}
+
+// CreateAPIKey creates an API key for the current user. The key is returned once and only its hash is stored.
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+	var req models.CreateAPIKeyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	if utils.Contains(req.Scopes, models.APIKeyScopeAdmin) && len(currentUser.Permissions) == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only users with admin permissions can create keys with the admin scope",
+		})
+	}
+
+	lifetime := h.config.APIKeyDefaultTTL
+	if req.ExpiresInDays > 0 {
+		lifetime = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	if lifetime > h.config.APIKeyMaxTTL {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("API keys can be valid for at most %d days", int(h.config.APIKeyMaxTTL.Hours()/24)),
+		})
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate API key",
+		})
+	}
+
+	expiresAt := time.Now().Add(lifetime)
+	apiKey := models.APIKey{
+		UserID:    currentUser.UserID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(key),
+		Scopes:    strings.Join(req.Scopes, " "),
+		ExpiresAt: &expiresAt,
+	}
+
+	if err := h.db.Create(&apiKey).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create API key",
+		})
+	}
+
+	response := apiKey.ToResponse()
+	response.Key = key
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "API key created successfully. Store it now, it will not be shown again",
+		"api_key": response,
+	})
+}
+
+// RevokeAPIKey revokes one of the current user's API keys. Revoked keys stay listed for reference.
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	result := h.db.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Params("id"), currentUser.UserID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke API key",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "API key revoked successfully",
+	})
+}
@@ -1,29 +1,51 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+
+	"golang-base/internal/account"
+	"golang-base/internal/auth"
 	"golang-base/internal/config"
+	"golang-base/internal/mailer"
+	"golang-base/internal/middleware"
 	"golang-base/internal/models"
 	"golang-base/pkg/utils"
-	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	db       *gorm.DB
-	config   *config.Config
-	validate *validator.Validate
+	db          *gorm.DB
+	config      *config.Config
+	validate    *validator.Validate
+	tokens      *auth.TokenIssuer
+	revocations *auth.RevocationList
+	guard       *auth.LoginGuard
+	mailer      mailer.Sender
+
+	// dummyHash is compared against when no account matches, so unknown emails take as long as wrong passwords
+	dummyHash []byte
 }
 
-func NewAuthHandler(db *gorm.DB, cfg *config.Config) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, revocations *auth.RevocationList, guard *auth.LoginGuard, mailer mailer.Sender) *AuthHandler {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("no account matches this login"), cfg.BCryptCost)
+	if err != nil {
+		log.Fatal("Failed to hash dummy password:", err)
+	}
+
 	return &AuthHandler{
-		db:       db,
-		config:   cfg,
-		validate: validator.New(),
+		db:          db,
+		config:      cfg,
+		validate:    validator.New(),
+		tokens:      tokens,
+		revocations: revocations,
+		guard:       guard,
+		mailer:      mailer,
+		dummyHash:   dummyHash,
 	}
 }
 
@@ -43,40 +65,32 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if user already exists
-	var existingUser models.User
-	if err := h.db.Where("email = ?", req.Email).First(&existingUser).Error; err == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"error": "User already exists",
-		})
-	}
-
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), h.config.BCryptCost)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to hash password",
-		})
-	}
-
-	// Create user
 	user := models.User{
 		Email:     req.Email,
-		Password:  string(hashedPassword),
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
-		Role:      "user",
+		Role:      models.RoleUser,
 		Active:    true,
 	}
-
-	if err := h.db.Create(&user).Error; err != nil {
+	err := account.Create(h.db, h.config.BCryptCost, &user, req.Password)
+	if errors.Is(err, account.ErrExists) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User already exists",
+		})
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
 	}
 
+	// The account exists at this point; a failed email can be retried through the resend endpoint
+	if err := h.sendVerificationEmail(c, &user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "User created successfully",
+		"message": "User created successfully. Please check your email to verify your address",
 		"user":    user.ToResponse(),
 	})
 }
@@ -97,110 +111,196 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
-	// Find user
+	// Find user; unknown and deactivated emails are answered like a wrong password
 	var user models.User
-	if err := h.db.Where("email = ? AND active = ?", req.Email, true).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
+	err := h.db.Where("email = ? AND active = ?", req.Email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		bcrypt.CompareHashAndPassword(h.dummyHash, []byte(req.Password))
+		return rejectUnknownLogin(c, h.guard, req.Email, "Invalid credentials")
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to find user",
 		})
 	}
 
+	// Reject attempts while the account is locked or throttled
+	if lockout := h.guard.Check(&user); lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
+		return rejectFailedLogin(c, h.guard, &user, "Invalid credentials")
+	}
+
+	// Check email verification policy
+	if h.config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Email address not verified",
 		})
 	}
 
-	// Generate JWT token
-	token, err := h.generateJWT(&user)
+	return h.finishLogin(c, &user)
+}
+
+// RefreshToken exchanges a refresh token for a new token pair.
+// The presented token is rotated: it can only be used once, and presenting an
+// already rotated token revokes every token in its family.
+// Browsers may omit the body; the refresh token is then read from the session cookie.
+// No CSRF token is required: the SameSite cookie is not sent cross-site, and a forged
+// request could only rotate the victim's tokens without ever seeing them.
+func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
+	var req models.RefreshRequest
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	if req.RefreshToken == "" {
+		req.RefreshToken = c.Cookies(middleware.RefreshTokenCookie)
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	tokens, user, err := h.tokens.RotateRefreshToken(h.db, req.RefreshToken, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		middleware.ClearSessionCookies(c, h.config)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Refresh token reuse detected",
+		})
+	}
+	if errors.Is(err, auth.ErrInvalidRefreshToken) {
+		middleware.ClearSessionCookies(c, h.config)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid refresh token",
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
+	middleware.SetSessionCookies(c, h.config, tokens)
+	return c.JSON(tokenResponse("Token refreshed successfully", tokens, user))
+}
+
+// Logout revokes the current access token and the refresh tokens of its session
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	if err := h.revokeCurrentSession(middleware.CurrentUser(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke token",
+		})
+	}
+
+	middleware.ClearSessionCookies(c, h.config)
 	return c.JSON(fiber.Map{
-		"message": "Login successful",
-		"token":   token,
-		"user":    user.ToResponse(),
+		"message": "Logged out successfully",
 	})
 }
 
-// RefreshToken handles token refresh
-func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
-	// Get token from Authorization header
-	tokenString := c.Get("Authorization")
-	if tokenString == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Authorization header required",
-		})
+// WebLogout handles the dashboard's logout form: it revokes the cookie session and returns to the login page
+func (h *AuthHandler) WebLogout(c *fiber.Ctx) error {
+	if err := h.revokeCurrentSession(middleware.CurrentUser(c)); err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Failed to revoke session")
 	}
 
-	// Remove "Bearer " prefix
-	if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-		tokenString = tokenString[7:]
+	middleware.ClearSessionCookies(c, h.config)
+	return c.Redirect("/login")
+}
+
+// LogoutAll revokes every access and refresh token of the current user on all devices
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	if err := h.revocations.RevokeAllForUser(h.db, currentUser.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke tokens",
+		})
 	}
 
-	// Parse token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(h.config.JWTSecret), nil
+	middleware.ClearSessionCookies(c, h.config)
+	return c.JSON(fiber.Map{
+		"message": "Logged out from all devices",
 	})
+}
 
-	if err != nil || !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid token",
-		})
+// revokeCurrentSession revokes the presented access token and the refresh tokens of its session
+func (h *AuthHandler) revokeCurrentSession(currentUser *models.JWTCustomClaims) error {
+	if err := h.revocations.RevokeToken(currentUser.ID, currentUser.UserID, currentUser.ExpiresAt.Time); err != nil {
+		return err
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid token claims",
+	if currentUser.SessionID != "" {
+		return auth.RevokeSession(h.db, currentUser.SessionID)
+	}
+
+	return nil
+}
+
+// finishLogin completes a login once the first factor has been checked: it answers
+// with an MFA challenge when a second factor is needed, otherwise with a new token pair
+func (h *AuthHandler) finishLogin(c *fiber.Ctx, user *models.User) error {
+	// Require a second factor when enabled for the user or enforced for their role
+	mfaMethods, mfaRequired, err := mfaStatus(h.db, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check MFA policy",
 		})
 	}
 
-	userID, ok := claims["user_id"].(float64)
-	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid user ID in token",
+	if mfaRequired {
+		challenge, err := h.tokens.GenerateMFAChallenge(user, len(mfaMethods) == 0)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate MFA challenge",
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"message":                 "Multi-factor authentication required",
+			"mfa_required":            true,
+			"mfa_enrollment_required": len(mfaMethods) == 0,
+			"mfa_methods":             mfaMethods,
+			"mfa_token":               challenge,
 		})
 	}
 
-	// Find user
-	var user models.User
-	if err := h.db.Where("id = ? AND active = ?", uint(userID), true).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not found",
+	if err := h.guard.RecordSuccess(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record login attempt",
 		})
 	}
 
-	// Generate new token
-	newToken, err := h.generateJWT(&user)
+	// Issue access and refresh tokens for a new token family
+	tokens, err := h.tokens.StartSession(h.db, user, c.IP(), c.Get(fiber.HeaderUserAgent))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Token refreshed successfully",
-		"token":   newToken,
-		"user":    user.ToResponse(),
-	})
+	middleware.SetSessionCookies(c, h.config, tokens)
+	return c.JSON(tokenResponse("Login successful", tokens, user))
 }
 
-// generateJWT generates a JWT token for the user
-func (h *AuthHandler) generateJWT(user *models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"role":    user.Role,
-		"exp":     time.Now().Add(h.config.SessionTimeout).Unix(),
-		"iat":     time.Now().Unix(),
+// tokenResponse builds the response body returned whenever a token pair is issued
+func tokenResponse(message string, tokens *auth.TokenPair, user *models.User) fiber.Map {
+	return fiber.Map{
+		"message":       message,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"csrf_token":    tokens.CSRFToken,
+		"user":          user.ToResponse(),
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(h.config.JWTSecret))
 }
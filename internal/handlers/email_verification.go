@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/mailer"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const emailVerificationPurpose = "email-verification"
+
+// VerifyEmail confirms a user's email address using a verification token
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req models.VerifyEmailRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	if !auth.VerifySignedToken(h.config.JWTSecret, emailVerificationPurpose, req.Token) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+
+	var stored models.EmailVerificationToken
+	if err := h.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.Token), time.Now()).
+		First(&stored).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Consume the token; the conditional update makes it single-use under concurrency
+		result := tx.Model(&models.EmailVerificationToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", stored.UserID).
+			Update("email_verified_at", now).Error
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification token",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
+
+// ResendVerification sends a new verification email.
+// The response is the same whether or not the address belongs to an unverified account.
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	var req models.ResendVerificationRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ? AND active = ? AND email_verified_at IS NULL", req.Email, true).First(&user).Error; err == nil {
+		if err := h.sendVerificationEmail(c, &user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If the account exists and is not yet verified, a verification email has been sent",
+	})
+}
+
+// sendVerificationEmail invalidates outstanding verification tokens and mails a new one
+func (h *AuthHandler) sendVerificationEmail(c *fiber.Ctx, user *models.User) error {
+	token, err := auth.NewSignedToken(h.config.JWTSecret, emailVerificationPurpose)
+	if err != nil {
+		return err
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailVerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.EmailVerificationToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(h.config.EmailVerificationTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.config.AppBaseURL, token)
+	return h.mailer.Send(c.UserContext(), mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			user.FirstName, link, h.config.EmailVerificationTTL),
+	})
+}
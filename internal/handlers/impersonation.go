@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ImpersonateUser issues a short-lived access token that lets an admin see the application
+// exactly as a user does (admin only). The token cannot be refreshed, cannot be used for
+// actions reserved to the account owner, and is recorded in the audit log.
+// Users holding any permission cannot be impersonated, and impersonation tokens carry no
+// permissions, so impersonation never grants admin access.
+func (h *UserHandler) ImpersonateUser(c *fiber.Ctx) error {
+	var req models.ImpersonateRequest
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	currentUser := middleware.CurrentUser(c)
+
+	var actor models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&actor).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", c.Params("id")).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.ID == actor.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot impersonate yourself",
+		})
+	}
+
+	grants, err := h.access.Grants(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch roles",
+		})
+	}
+	if len(grants.Permissions) > 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Users with admin permissions cannot be impersonated",
+		})
+	}
+
+	if !user.Active {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Inactive users cannot be impersonated",
+		})
+	}
+
+	token, claims, err := h.tokens.GenerateImpersonationJWT(&user, &actor)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	// An impersonation that cannot be audited is not started
+	details := fmt.Sprintf("token_id=%s expires_at=%s", claims.ID, claims.ExpiresAt.Time.UTC().Format(time.RFC3339))
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		details += " reason=" + reason
+	}
+	if err := recordAudit(c, h.db, models.AuditActionImpersonationStart, user.ID, details); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":      "Impersonation started",
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(h.config.ImpersonationTTL.Seconds()),
+		"user":         user.ToResponse(),
+		"impersonator": claims.Actor,
+	})
+}
+
+// StopImpersonation revokes the presented impersonation token and records the end of the impersonation
+func (h *UserHandler) StopImpersonation(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+	if !currentUser.Impersonating() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Not impersonating a user",
+		})
+	}
+
+	if err := h.revocations.RevokeToken(currentUser.ID, currentUser.UserID, currentUser.ExpiresAt.Time); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke token",
+		})
+	}
+
+	if err := recordAudit(c, h.db, models.AuditActionImpersonationStop, currentUser.UserID, "token_id="+currentUser.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Impersonation stopped",
+	})
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang-base/internal/account"
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/mailer"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const invitationPurpose = "invitation"
+
+// errInvitationInvalid is returned for unknown invitation tokens and invitations that are no longer pending
+var errInvitationInvalid = errors.New("invalid or expired invitation")
+
+// pendingInvitation selects invitations that can still be accepted
+const pendingInvitation = "accepted_at IS NULL AND declined_at IS NULL AND revoked_at IS NULL AND expires_at > ?"
+
+type InvitationHandler struct {
+	db       *gorm.DB
+	config   *config.Config
+	validate *validator.Validate
+	mailer   mailer.Sender
+	access   *auth.AccessControl
+}
+
+func NewInvitationHandler(db *gorm.DB, cfg *config.Config, mailer mailer.Sender, access *auth.AccessControl) *InvitationHandler {
+	return &InvitationHandler{
+		db:       db,
+		config:   cfg,
+		validate: validator.New(),
+		mailer:   mailer,
+		access:   access,
+	}
+}
+
+// CreateInvitation emails an invitation with a preassigned role (users:invite). Within an
+// organization the role is the membership role in it. The role may not grant permissions
+// the inviter does not hold. Inviting the same address again replaces the pending invitation.
+func (h *InvitationHandler) CreateInvitation(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+	current := middleware.CurrentTenant(c)
+
+	var req models.CreateInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var roles int64
+	if err := h.db.Model(&models.Role{}).Where("name = ?", req.Role).Count(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invitation",
+		})
+	}
+	if roles == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown role: " + req.Role,
+		})
+	}
+
+	if err := checkGrantable(c, h.access, []string{req.Role}); err != nil {
+		return grantError(c, err, "Failed to create invitation")
+	}
+
+	invitation := models.Invitation{
+		Email:       req.Email,
+		Role:        req.Role,
+		InvitedByID: &currentUser.UserID,
+		ExpiresAt:   time.Now().Add(h.config.InvitationTTL),
+	}
+	if actor := middleware.Actor(c); actor != nil {
+		invitation.InvitedByID = &actor.UserID
+	}
+
+	if current != nil {
+		var organization models.Organization
+		if err := h.db.Where("id = ?", current.OrganizationID).First(&organization).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create invitation",
+			})
+		}
+		invitation.OrganizationID = &organization.ID
+		invitation.Organization = &organization
+
+		var members int64
+		if err := h.db.Model(&models.Membership{}).
+			Joins("JOIN users ON users.id = memberships.user_id").
+			Where("memberships.organization_id = ? AND users.email = ?", organization.ID, req.Email).
+			Count(&members).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to create invitation",
+			})
+		}
+		if members > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "User is already a member of this organization",
+			})
+		}
+	}
+
+	token, err := auth.NewSignedToken(h.config.JWTSecret, invitationPurpose)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invitation",
+		})
+	}
+	invitation.TokenHash = utils.HashToken(token)
+
+	// The invitation is only kept when its email could be sent
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		previous := tx.Model(&models.Invitation{}).Where("email = ?", invitation.Email).Where(pendingInvitation, time.Now())
+		if invitation.OrganizationID != nil {
+			previous = previous.Where("organization_id = ?", *invitation.OrganizationID)
+		} else {
+			previous = previous.Where("organization_id IS NULL")
+		}
+		if err := previous.Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		return h.sendInvitationEmail(c, &invitation, currentUser.Email, token)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to send invitation",
+		})
+	}
+
+	if err := recordOrganizationAudit(c, h.db, invitationOrganization(&invitation), models.AuditActionInvitationCreate, 0, describeInvitation(&invitation)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":    "Invitation sent successfully",
+		"invitation": invitation.ToResponse(),
+	})
+}
+
+// GetInvitations lists pending invitations, newest first (users:invite).
+// Within an organization only its invitations are listed.
+func (h *InvitationHandler) GetInvitations(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var invitations []models.Invitation
+	if err := h.db.WithContext(c.UserContext()).Preload("Organization").
+		Where(pendingInvitation, time.Now()).
+		Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).
+		Find(&invitations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch invitations",
+		})
+	}
+
+	responses := make([]models.InvitationResponse, len(invitations))
+	for i := range invitations {
+		responses[i] = invitations[i].ToResponse()
+	}
+
+	return c.JSON(fiber.Map{
+		"invitations": responses,
+		"page":        page,
+		"limit":       limit,
+	})
+}
+
+// RevokeInvitation withdraws a pending invitation, so its link stops working (users:invite)
+func (h *InvitationHandler) RevokeInvitation(c *fiber.Ctx) error {
+	var invitation models.Invitation
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", c.Params("id")).First(&invitation).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Invitation not found",
+		})
+	}
+
+	result := h.db.Model(&models.Invitation{}).
+		Where("id = ?", invitation.ID).Where(pendingInvitation, time.Now()).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke invitation",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Invitation is no longer pending",
+		})
+	}
+
+	if err := recordOrganizationAudit(c, h.db, invitationOrganization(&invitation), models.AuditActionInvitationRevoke, 0, describeInvitation(&invitation)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation revoked successfully",
+	})
+}
+
+// GetInvitation describes the invitation behind a link, for the page that accepts it.
+// existing_account tells whether accepting creates an account or joins an existing one.
+func (h *InvitationHandler) GetInvitation(c *fiber.Ctx) error {
+	var req models.InvitationTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	invitation, err := h.findPendingInvitation(req.Token)
+	if err != nil {
+		return h.invitationError(c, err)
+	}
+
+	var users int64
+	if err := h.db.Model(&models.User{}).Where("email = ?", invitation.Email).Count(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch invitation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"invitation":       invitation.ToResponse(),
+		"existing_account": users > 0,
+	})
+}
+
+// AcceptInvitation accepts an invitation. Without an account for the invited address, one is
+// created through the same path as registration, already verified since the link proves the
+// address; otherwise the role or membership is added to the existing account.
+func (h *InvitationHandler) AcceptInvitation(c *fiber.Ctx) error {
+	var req models.AcceptInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	invitation, err := h.findPendingInvitation(req.Token)
+	if err != nil {
+		return h.invitationError(c, err)
+	}
+
+	var roles int64
+	if err := h.db.Model(&models.Role{}).Where("name = ?", invitation.Role).Count(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to accept invitation",
+		})
+	}
+	if roles == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "The invited role no longer exists; ask for a new invitation",
+		})
+	}
+
+	var user *models.User
+	var registration *models.RegisterRequest
+	var existing models.User
+	err = h.db.Where("email = ?", invitation.Email).First(&existing).Error
+	switch {
+	case err == nil:
+		user = &existing
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		registration = &models.RegisterRequest{
+			Email:     invitation.Email,
+			Password:  req.Password,
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+		}
+		if err := h.validate.Struct(registration); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": utils.FormatValidationErrors(err),
+			})
+		}
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to accept invitation",
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Consume the invitation first, so concurrent requests cannot both accept it
+		now := time.Now()
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ?", invitation.ID).Where(pendingInvitation, now).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationInvalid
+		}
+
+		if registration != nil {
+			role := invitation.Role
+			if invitation.OrganizationID != nil {
+				role = models.RoleUser
+			}
+
+			now := time.Now()
+			user = &models.User{
+				Email:           registration.Email,
+				FirstName:       registration.FirstName,
+				LastName:        registration.LastName,
+				Role:            role,
+				Active:          true,
+				EmailVerifiedAt: &now,
+			}
+			if err := account.Create(tx, h.config.BCryptCost, user, registration.Password); err != nil {
+				return err
+			}
+		} else if err := linkInvitedAccount(tx, invitation, user); err != nil {
+			return err
+		}
+
+		if invitation.OrganizationID != nil {
+			membership := models.Membership{OrganizationID: *invitation.OrganizationID, UserID: user.ID, Role: invitation.Role}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "organization_id"}, {Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+			}).Create(&membership).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&models.Invitation{}).Where("id = ?", invitation.ID).Update("user_id", user.ID).Error
+	})
+	if errors.Is(err, errInvitationInvalid) || errors.Is(err, account.ErrExists) {
+		return h.invitationError(c, errInvitationInvalid)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to accept invitation",
+		})
+	}
+	h.access.Invalidate(user.ID)
+
+	if err := recordOrganizationAudit(c, h.db, invitationOrganization(invitation), models.AuditActionInvitationAccept, user.ID, describeInvitation(invitation)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	status := fiber.StatusOK
+	if registration != nil {
+		status = fiber.StatusCreated
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"message": "Invitation accepted. You can now log in",
+		"user":    user.ToResponse(),
+	})
+}
+
+// DeclineInvitation declines an invitation, so its link stops working
+func (h *InvitationHandler) DeclineInvitation(c *fiber.Ctx) error {
+	var req models.InvitationTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	invitation, err := h.findPendingInvitation(req.Token)
+	if err != nil {
+		return h.invitationError(c, err)
+	}
+
+	result := h.db.Model(&models.Invitation{}).
+		Where("id = ?", invitation.ID).Where(pendingInvitation, time.Now()).
+		Update("declined_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to decline invitation",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return h.invitationError(c, errInvitationInvalid)
+	}
+
+	if err := recordOrganizationAudit(c, h.db, invitationOrganization(invitation), models.AuditActionInvitationDecline, 0, describeInvitation(invitation)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation declined",
+	})
+}
+
+// linkInvitedAccount gives an existing account the role of an invitation made outside
+// organizations, as an additional role, and marks its address as verified
+func linkInvitedAccount(tx *gorm.DB, invitation *models.Invitation, user *models.User) error {
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		if err := tx.Model(user).Update("email_verified_at", now).Error; err != nil {
+			return err
+		}
+	}
+
+	if invitation.OrganizationID != nil || invitation.Role == user.Role {
+		return nil
+	}
+
+	var role models.Role
+	if err := tx.Where("name = ?", invitation.Role).First(&role).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.UserRole{UserID: user.ID, RoleID: role.ID}).Error
+}
+
+// findPendingInvitation loads the invitation behind a link token, if it can still be accepted
+func (h *InvitationHandler) findPendingInvitation(token string) (*models.Invitation, error) {
+	if !auth.VerifySignedToken(h.config.JWTSecret, invitationPurpose, token) {
+		return nil, errInvitationInvalid
+	}
+
+	var invitation models.Invitation
+	if err := h.db.Preload("Organization").Where("token_hash = ?", utils.HashToken(token)).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errInvitationInvalid
+		}
+		return nil, err
+	}
+	if invitation.Status() != models.InvitationPending {
+		return nil, errInvitationInvalid
+	}
+	return &invitation, nil
+}
+
+// invitationError answers a failed invitation lookup
+func (h *InvitationHandler) invitationError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errInvitationInvalid) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired invitation",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to fetch invitation",
+	})
+}
+
+// sendInvitationEmail mails the invitation link
+func (h *InvitationHandler) sendInvitationEmail(c *fiber.Ctx, invitation *models.Invitation, inviter, token string) error {
+	target := h.config.AppBaseURL
+	if invitation.Organization != nil {
+		target = invitation.Organization.Name
+	}
+
+	link := fmt.Sprintf("%s/invitation?token=%s", h.config.AppBaseURL, token)
+	return h.mailer.Send(c.UserContext(), mailer.Message{
+		To:      invitation.Email,
+		Subject: "You have been invited to join " + target,
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to join %s with the role %q.\n\n"+
+			"Open the link below to accept or decline the invitation:\n\n%s\n\n"+
+			"The link expires in %s. If you were not expecting this invitation, you can ignore this email.\n",
+			inviter, target, invitation.Role, link, h.config.InvitationTTL),
+	})
+}
+
+// invitationOrganization returns the organization an invitation is for, or zero
+func invitationOrganization(invitation *models.Invitation) uint {
+	if invitation.OrganizationID == nil {
+		return 0
+	}
+	return *invitation.OrganizationID
+}
+
+// describeInvitation summarizes an invitation for the audit log
+func describeInvitation(invitation *models.Invitation) string {
+	details := fmt.Sprintf("invitation=%d email=%s role=%s", invitation.ID, invitation.Email, invitation.Role)
+	if invitation.Organization != nil {
+		details += " organization=" + invitation.Organization.Slug
+	}
+	return details
+}
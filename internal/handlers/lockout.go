@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// lockoutResponse renders a lockout or throttling error in a consistent shape
+func lockoutResponse(c *fiber.Ctx, lockout *auth.LockoutError) error {
+	retryAfter := int(math.Ceil(lockout.RetryAfter.Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+
+	if lockout.Code == auth.LockoutCodeLocked {
+		return c.Status(fiber.StatusLocked).JSON(fiber.Map{
+			"error":        "Account temporarily locked due to too many failed login attempts",
+			"code":         lockout.Code,
+			"retry_after":  retryAfter,
+			"locked_until": lockout.LockedUntil,
+		})
+	}
+
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error":       "Too many failed login attempts, please wait before trying again",
+		"code":        lockout.Code,
+		"retry_after": retryAfter,
+	})
+}
+
+// rejectFailedLogin records a failed login attempt and responds with the failure,
+// or with the lockout it triggered
+func rejectFailedLogin(c *fiber.Ctx, guard *auth.LoginGuard, user *models.User, message string) error {
+	lockout, err := guard.RecordFailure(user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record login attempt",
+		})
+	}
+
+	if lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// rejectUnknownLogin answers a login for an email without an active account like a wrong
+// password, including the throttling and lockouts, which are kept per email address
+func rejectUnknownLogin(c *fiber.Ctx, guard *auth.LoginGuard, email string, message string) error {
+	lockout, err := guard.CheckEmail(email)
+	if err == nil && lockout == nil {
+		lockout, err = guard.RecordEmailFailure(email)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record login attempt",
+		})
+	}
+
+	if lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error": message,
+	})
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/mailer"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	magicLinkPurpose = "magic-link"
+
+	// magicLinkCooldown is how long a user must wait before another link is mailed,
+	// so the endpoint cannot be used to flood someone's inbox
+	magicLinkCooldown = time.Minute
+)
+
+// RequestMagicLink emails a single-use login link.
+// Links are only sent to active accounts whose role allows them and that are not
+// locked out; the response never reveals whether one was sent.
+func (h *AuthHandler) RequestMagicLink(c *fiber.Ctx) error {
+	var req models.MagicLinkRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ? AND active = ?", req.Email, true).First(&user).Error; err == nil &&
+		h.magicLinkAllowed(&user) && h.guard.Check(&user) == nil {
+		if err := h.sendMagicLinkEmail(c, &user); err != nil {
+			log.Printf("Failed to send login link to user %d: %v", user.ID, err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If this email can sign in with a link, one has been sent",
+	})
+}
+
+// VerifyMagicLink exchanges a login link token for a session. It is accounted like a
+// password login: locked accounts are rejected, reused or expired links count as failed
+// attempts, and MFA still applies. Opening the link also proves ownership of the email address.
+func (h *AuthHandler) VerifyMagicLink(c *fiber.Ctx) error {
+	var req models.MagicLinkVerifyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	if !auth.VerifySignedToken(h.config.JWTSecret, magicLinkPurpose, req.Token) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired login link",
+		})
+	}
+
+	var stored models.MagicLinkToken
+	if err := h.db.Where("token_hash = ?", utils.HashToken(req.Token)).First(&stored).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired login link",
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ? AND active = ?", stored.UserID, true).First(&user).Error; err != nil || !h.magicLinkAllowed(&user) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired login link",
+		})
+	}
+
+	if lockout := h.guard.Check(&user); lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	// Consume every outstanding link of the user; the conditional update on this one
+	// makes sure concurrent requests cannot both log in with it
+	now := time.Now()
+	result := h.db.Model(&models.MagicLinkToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", stored.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify login link",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return rejectFailedLogin(c, h.guard, &user, "Invalid or expired login link")
+	}
+
+	if err := h.db.Model(&models.MagicLinkToken{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Update("used_at", now).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify login link",
+		})
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := h.db.Model(&user).Update("email_verified_at", now).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to verify login link",
+			})
+		}
+	}
+
+	return h.finishLogin(c, &user)
+}
+
+// magicLinkAllowed reports whether every role of the user allows logging in with a link,
+// so that an additional privileged role cannot be reached through an emailed link
+func (h *AuthHandler) magicLinkAllowed(user *models.User) bool {
+	roles, err := auth.UserRoles(h.db, user)
+	if err != nil {
+		return false
+	}
+	for _, role := range roles {
+		if !h.config.MagicLinkAllowed(role) {
+			return false
+		}
+	}
+	return true
+}
+
+// sendMagicLinkEmail stores a new login token and mails the login link,
+// unless one was already sent within the cooldown
+func (h *AuthHandler) sendMagicLinkEmail(c *fiber.Ctx, user *models.User) error {
+	var recent int64
+	if err := h.db.Model(&models.MagicLinkToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-magicLinkCooldown)).
+		Count(&recent).Error; err != nil {
+		return err
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	token, err := auth.NewSignedToken(h.config.JWTSecret, magicLinkPurpose)
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.Create(&models.MagicLinkToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(h.config.MagicLinkTTL),
+	}).Error; err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", h.config.AppBaseURL, token)
+	return h.mailer.Send(c.UserContext(), mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to log in:\n\n%s\n\n"+
+			"The link expires in %s and can only be used once. If you did not request it, you can ignore this email.\n",
+			user.FirstName, link, h.config.MagicLinkTTL),
+	})
+}
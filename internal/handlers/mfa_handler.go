@@ -0,0 +1,870 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/internal/passkey"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errInvalidMFAChallenge  = errors.New("invalid MFA challenge")
+	errEnrollmentNotAllowed = errors.New("MFA enrollment not allowed")
+)
+
+type MFAHandler struct {
+	db          *gorm.DB
+	config      *config.Config
+	validate    *validator.Validate
+	tokens      *auth.TokenIssuer
+	revocations *auth.RevocationList
+	guard       *auth.LoginGuard
+	cipher      *auth.Cipher
+	passkeys    *passkey.Service
+}
+
+func NewMFAHandler(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, revocations *auth.RevocationList, guard *auth.LoginGuard, cipher *auth.Cipher, passkeys *passkey.Service) *MFAHandler {
+	return &MFAHandler{
+		db:          db,
+		config:      cfg,
+		validate:    validator.New(),
+		tokens:      tokens,
+		revocations: revocations,
+		guard:       guard,
+		cipher:      cipher,
+		passkeys:    passkeys,
+	}
+}
+
+// Verify completes a login by answering an MFA challenge with a TOTP or recovery code
+func (h *MFAHandler) Verify(c *fiber.Ctx) error {
+	var req models.MFAVerifyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	challenge, user, err := h.resolveChallenge(req.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+
+	if !user.MFAEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "MFA enrollment required",
+		})
+	}
+
+	if lockout := h.guard.Check(user); lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	var valid bool
+	if req.Code != "" {
+		valid = h.checkTOTP(user, req.Code)
+	} else {
+		valid = h.consumeRecoveryCode(user.ID, req.RecoveryCode)
+	}
+
+	if !valid {
+		return rejectFailedLogin(c, h.guard, user, "Invalid authentication code")
+	}
+
+	if err := h.consumeChallenge(challenge, user); err != nil {
+		return challengeError(c, err)
+	}
+
+	return h.completeLogin(c, user, nil)
+}
+
+// WebAuthnBegin starts answering an MFA challenge with one of the user's passkeys
+func (h *MFAHandler) WebAuthnBegin(c *fiber.Ctx) error {
+	var req models.MFAWebAuthnBeginRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	_, user, err := h.resolveChallenge(req.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+
+	if lockout := h.guard.Check(user); lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	assertion, challengeID, err := h.passkeys.BeginLogin(user)
+	if errors.Is(err, passkey.ErrNoCredentials) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "No passkeys registered",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start passkey login",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"challenge_id": challengeID,
+		"options":      assertion,
+	})
+}
+
+// WebAuthnVerify completes a login by answering an MFA challenge with a passkey assertion
+func (h *MFAHandler) WebAuthnVerify(c *fiber.Ctx) error {
+	var req models.MFAWebAuthnVerifyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	challenge, user, err := h.resolveChallenge(req.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+
+	if lockout := h.guard.Check(user); lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	if _, err := h.passkeys.FinishLogin(user, req.ChallengeID, req.Credential); err != nil {
+		if errors.Is(err, passkey.ErrInvalidChallenge) || errors.Is(err, passkey.ErrVerificationFailed) || errors.Is(err, passkey.ErrClonedAuthenticator) {
+			return rejectFailedLogin(c, h.guard, user, "Passkey verification failed")
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify passkey",
+		})
+	}
+
+	if err := h.consumeChallenge(challenge, user); err != nil {
+		return challengeError(c, err)
+	}
+
+	return h.completeLogin(c, user, nil)
+}
+
+// Enroll starts TOTP enrollment during login for users whose role requires MFA
+func (h *MFAHandler) Enroll(c *fiber.Ctx) error {
+	var req models.MFAEnrollRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	challenge, user, err := h.resolveChallenge(req.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+
+	if err := h.checkEnrollment(challenge, user); err != nil {
+		return enrollmentError(c, err)
+	}
+
+	return h.startTOTPSetup(c, user)
+}
+
+// EnrollConfirm finishes an enrollment started during login and completes the login
+func (h *MFAHandler) EnrollConfirm(c *fiber.Ctx) error {
+	var req models.MFAEnrollConfirmRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	challenge, user, err := h.resolveChallenge(req.MFAToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+
+	if err := h.checkEnrollment(challenge, user); err != nil {
+		return enrollmentError(c, err)
+	}
+
+	if user.MFAEnabled || user.TOTPSecret == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "No pending MFA enrollment",
+		})
+	}
+
+	if lockout := h.guard.Check(user); lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	if !h.checkTOTP(user, req.Code) {
+		return rejectFailedLogin(c, h.guard, user, "Invalid authentication code")
+	}
+
+	// Consumed before activation, so a concurrent request cannot replace the recovery codes
+	if err := h.consumeChallenge(challenge, user); err != nil {
+		return challengeError(c, err)
+	}
+
+	codes, err := h.activateTOTP(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to enable MFA",
+		})
+	}
+	user.MFAEnabled = true
+
+	return h.completeLogin(c, user, codes)
+}
+
+// SetupTOTP generates a new TOTP secret for the current user, pending confirmation
+func (h *MFAHandler) SetupTOTP(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return h.startTOTPSetup(c, user)
+}
+
+// TOTPQRCode renders the pending TOTP provisioning URI as a PNG or SVG QR code
+func (h *MFAHandler) TOTPQRCode(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.MFAEnabled || user.TOTPSecret == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "No pending MFA enrollment",
+		})
+	}
+
+	secret, err := h.cipher.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read TOTP secret",
+		})
+	}
+	uri := auth.TOTPURI(h.config.MFAIssuer, user.Email, secret)
+
+	// Provisioning secrets must never be cached by browsers or proxies
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	if c.Query("format", "png") == "svg" {
+		svg, err := utils.QRCodeSVG(uri)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to render QR code",
+			})
+		}
+		c.Set(fiber.HeaderContentType, "image/svg+xml")
+		return c.SendString(svg)
+	}
+
+	png, err := utils.QRCodePNG(uri, 256)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render QR code",
+		})
+	}
+	c.Set(fiber.HeaderContentType, "image/png")
+	return c.Send(png)
+}
+
+// EnableTOTP confirms the pending TOTP secret and returns one-time recovery codes
+func (h *MFAHandler) EnableTOTP(c *fiber.Ctx) error {
+	var req models.TOTPCodeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	user, err := h.currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if user.MFAEnabled || user.TOTPSecret == "" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "No pending MFA enrollment",
+		})
+	}
+
+	if !h.checkTOTP(user, req.Code) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid authentication code",
+		})
+	}
+
+	codes, err := h.activateTOTP(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to enable MFA",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "MFA enabled successfully. Store your recovery codes in a safe place",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP turns off TOTP for the current user unless their role requires MFA
+// and they have no passkey to fall back on
+func (h *MFAHandler) DisableTOTP(c *fiber.Ctx) error {
+	var req models.TOTPDisableRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	user, err := h.currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.MFAEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "MFA is not enabled",
+		})
+	}
+
+	// A registered passkey still satisfies the role policy once TOTP is off
+	methods, _, err := mfaStatus(h.db, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check MFA policy",
+		})
+	}
+	required, err := roleRequiresMFA(h.db, user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check MFA policy",
+		})
+	}
+	if required && !slices.Contains(methods, models.MFAMethodWebAuthn) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "MFA is required for your role",
+		})
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil || !h.checkTOTP(user, req.Code) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid password or authentication code",
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"mfa_enabled":    false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.MFARecoveryCode{}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to disable MFA",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "MFA disabled successfully",
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the current user
+func (h *MFAHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	var req models.TOTPCodeRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	user, err := h.currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if !user.MFAEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "MFA is not enabled",
+		})
+	}
+
+	if !h.checkTOTP(user, req.Code) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid authentication code",
+		})
+	}
+
+	var codes []string
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate recovery codes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Recovery codes regenerated successfully",
+		"recovery_codes": codes,
+	})
+}
+
+// GetRolePolicies lists the roles for which MFA is configured (admin only)
+func (h *MFAHandler) GetRolePolicies(c *fiber.Ctx) error {
+	var policies []models.MFARolePolicy
+	if err := h.db.Order("role").Find(&policies).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch MFA policies",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"policies": policies,
+	})
+}
+
+// UpdateRolePolicy sets whether MFA is required for a role (admin only)
+func (h *MFAHandler) UpdateRolePolicy(c *fiber.Ctx) error {
+	role := c.Params("role")
+
+	var req models.MFARolePolicyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var roles int64
+	if err := h.db.Model(&models.Role{}).Where("name = ?", role).Count(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update MFA policy",
+		})
+	}
+	if roles == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Role not found",
+		})
+	}
+
+	policy := models.MFARolePolicy{
+		Role:     role,
+		Required: *req.Required,
+	}
+	if err := h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"required"}),
+	}).Create(&policy).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update MFA policy",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "MFA policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+// resolveChallenge validates an MFA challenge token and loads the user it belongs to
+func (h *MFAHandler) resolveChallenge(token string) (*auth.MFAChallenge, *models.User, error) {
+	challenge, err := h.tokens.ParseMFAChallenge(token)
+	if err != nil || h.revocations.IsRevoked(challenge.ID) {
+		return nil, nil, errInvalidMFAChallenge
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ? AND active = ?", challenge.UserID, true).First(&user).Error; err != nil {
+		return nil, nil, errInvalidMFAChallenge
+	}
+
+	return challenge, &user, nil
+}
+
+// checkEnrollment allows enrolling a second factor during login only for challenges issued
+// because one was required and missing, and only while the user still has none. Otherwise
+// knowing the password would be enough to replace a user's passkey with a new TOTP secret.
+func (h *MFAHandler) checkEnrollment(challenge *auth.MFAChallenge, user *models.User) error {
+	if !challenge.Enrollment {
+		return errEnrollmentNotAllowed
+	}
+
+	methods, _, err := mfaStatus(h.db, user)
+	if err != nil {
+		return err
+	}
+	if len(methods) > 0 {
+		return errEnrollmentNotAllowed
+	}
+	return nil
+}
+
+// enrollmentError responds to a login-time enrollment that is not allowed
+func enrollmentError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errEnrollmentNotAllowed) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "A second factor is already registered; use it to log in",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to check MFA policy",
+	})
+}
+
+// consumeChallenge uses up an MFA challenge once its second factor was verified.
+// It returns errInvalidMFAChallenge if a concurrent request consumed it first.
+func (h *MFAHandler) consumeChallenge(challenge *auth.MFAChallenge, user *models.User) error {
+	consumed, err := h.revocations.ConsumeToken(challenge.ID, user.ID, challenge.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return errInvalidMFAChallenge
+	}
+	return nil
+}
+
+// challengeError responds to a challenge that could not be consumed
+func challengeError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errInvalidMFAChallenge) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired MFA token",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to complete login",
+	})
+}
+
+// completeLogin issues the real token pair after the MFA challenge was consumed
+func (h *MFAHandler) completeLogin(c *fiber.Ctx, user *models.User, recoveryCodes []string) error {
+	if err := h.guard.RecordSuccess(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record login attempt",
+		})
+	}
+
+	tokens, err := h.tokens.StartSession(h.db, user, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	middleware.SetSessionCookies(c, h.config, tokens)
+	response := tokenResponse("Login successful", tokens, user)
+	if recoveryCodes != nil {
+		response["recovery_codes"] = recoveryCodes
+	}
+
+	return c.JSON(response)
+}
+
+// currentUser loads the authenticated user
+func (h *MFAHandler) currentUser(c *fiber.Ctx) (*models.User, error) {
+	currentUser := middleware.CurrentUser(c)
+	if currentUser == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// startTOTPSetup stores a new pending TOTP secret and returns its provisioning details
+func (h *MFAHandler) startTOTPSetup(c *fiber.Ctx, user *models.User) error {
+	if user.MFAEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "MFA is already enabled",
+		})
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate TOTP secret",
+		})
+	}
+
+	encrypted, err := h.cipher.Encrypt(secret)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store TOTP secret",
+		})
+	}
+
+	if err := h.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_secret":    encrypted,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store TOTP secret",
+		})
+	}
+
+	uri := auth.TOTPURI(h.config.MFAIssuer, user.Email, secret)
+	png, err := utils.QRCodePNG(uri, 256)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render QR code",
+		})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{
+		"message":     "Scan the QR code with your authenticator app and confirm with a code",
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// checkTOTP validates a TOTP code and records its time step so the same code cannot be replayed
+func (h *MFAHandler) checkTOTP(user *models.User, code string) bool {
+	secret, err := h.cipher.Decrypt(user.TOTPSecret)
+	if err != nil {
+		return false
+	}
+
+	step, ok := auth.ValidateTOTP(secret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false
+	}
+
+	result := h.db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.TOTPLastStep = step
+
+	return true
+}
+
+// activateTOTP marks the pending secret as active and issues fresh recovery codes
+func (h *MFAHandler) activateTOTP(userID uint) ([]string, error) {
+	var codes []string
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("mfa_enabled", true).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+
+	return codes, err
+}
+
+// consumeRecoveryCode marks a matching unused recovery code as used
+func (h *MFAHandler) consumeRecoveryCode(userID uint, code string) bool {
+	result := h.db.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and stores a new hashed set
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.MFARecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.MFARecoveryCode{
+			UserID:   userID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode returns a random code formatted as xxxx-xxxx.
+// Base32 keeps codes case-insensitive and free of easily confused characters.
+func generateRecoveryCode() (string, error) {
+	raw := make([]byte, 5)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(raw))
+	return code[:4] + "-" + code[4:], nil
+}
+
+// normalizeRecoveryCode strips formatting so codes can be typed with or without dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// mfaStatus returns the second factors a user has set up ("totp", "webauthn") and
+// whether they have to pass one to log in: always when they have any, otherwise
+// when their role requires MFA, in which case they must enroll first
+func mfaStatus(db *gorm.DB, user *models.User) ([]string, bool, error) {
+	methods := []string{}
+	if user.MFAEnabled {
+		methods = append(methods, models.MFAMethodTOTP)
+	}
+
+	var passkeys int64
+	if err := db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&passkeys).Error; err != nil {
+		return nil, false, err
+	}
+	if passkeys > 0 {
+		methods = append(methods, models.MFAMethodWebAuthn)
+	}
+
+	if len(methods) > 0 {
+		return methods, true, nil
+	}
+
+	required, err := roleRequiresMFA(db, user)
+	return methods, required, err
+}
+
+// roleRequiresMFA reports whether MFA is enforced for any of the user's roles
+func roleRequiresMFA(db *gorm.DB, user *models.User) (bool, error) {
+	roles, err := auth.UserRoles(db, user)
+	if err != nil {
+		return false, err
+	}
+
+	var policies []models.MFARolePolicy
+	if err := db.Where("role IN ? AND required = ?", roles, true).Limit(1).Find(&policies).Error; err != nil {
+		return false, err
+	}
+	return len(policies) > 0, nil
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLoginEnrollmentRefusedWithPasskey(t *testing.T) {
+	db := openStubDB(t, []stubQuery{
+		{match: `FROM "users"`, columns: []string{"id", "email", "role", "active"}, rows: [][]any{{int64(7), "user@example.com", "user", true}}},
+		{match: `FROM "webauthn_credentials"`, columns: []string{"count"}, rows: [][]any{{int64(1)}}},
+	})
+
+	cfg := &config.Config{JWTSecret: "test-secret", MFAChallengeTTL: 5 * time.Minute}
+	tokens := auth.NewTokenIssuer(cfg, nil)
+	handler := NewMFAHandler(db, cfg, tokens, auth.NewRevocationList(db, time.Minute), nil, nil, nil)
+
+	app := fiber.New()
+	app.Post("/auth/mfa/enroll", handler.Enroll)
+	app.Post("/auth/mfa/enroll/confirm", handler.EnrollConfirm)
+
+	user := &models.User{ID: 7}
+	for _, enrollment := range []bool{true, false} {
+		token, err := tokens.GenerateMFAChallenge(user, enrollment)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		requests := map[string]any{
+			"/auth/mfa/enroll":         models.MFAEnrollRequest{MFAToken: token},
+			"/auth/mfa/enroll/confirm": models.MFAEnrollConfirmRequest{MFAToken: token, Code: "123456"},
+		}
+		for path, body := range requests {
+			payload, _ := json.Marshal(body)
+			req := httptest.NewRequest(fiber.MethodPost, path, bytes.NewReader(payload))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != fiber.StatusForbidden {
+				t.Errorf("POST %s with enrollment=%v: got status %d, want %d", path, enrollment, resp.StatusCode, fiber.StatusForbidden)
+			}
+		}
+	}
+}
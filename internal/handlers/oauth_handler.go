@@ -0,0 +1,668 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/internal/oidc"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// oauthCodeTTL is how long a client has to redeem an authorization code
+const oauthCodeTTL = time.Minute
+
+var errInvalidClient = errors.New("invalid client")
+
+// oauthError is an error response defined by RFC 6749
+type oauthError struct {
+	Code        string
+	Description string
+}
+
+type OAuthHandler struct {
+	db          *gorm.DB
+	config      *config.Config
+	validate    *validator.Validate
+	tokens      *auth.TokenIssuer
+	revocations *auth.RevocationList
+}
+
+func NewOAuthHandler(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, revocations *auth.RevocationList) *OAuthHandler {
+	return &OAuthHandler{
+		db:          db,
+		config:      cfg,
+		validate:    validator.New(),
+		tokens:      tokens,
+		revocations: revocations,
+	}
+}
+
+// Authorize shows the consent screen for an authorization request.
+// Clients the user already granted the requested scopes to receive a code straight away.
+func (h *OAuthHandler) Authorize(c *fiber.Ctx) error {
+	var req models.OAuthAuthorizeRequest
+	if err := c.QueryParser(&req); err != nil {
+		return h.renderError(c, "The authorization request is malformed.")
+	}
+
+	client, scopes, failure := h.checkAuthorizeRequest(&req)
+	if failure != nil {
+		return h.authorizeFailure(c, &req, client, *failure)
+	}
+
+	currentUser := middleware.CurrentUser(c)
+
+	var consent models.OAuthConsent
+	err := h.db.Where("user_id = ? AND client_id = ?", currentUser.UserID, client.ClientID).First(&consent).Error
+	if err == nil && isSubset(scopes, strings.Fields(consent.Scope)) {
+		return h.issueCode(c, &req, currentUser.UserID, scopes)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return h.renderError(c, "Failed to load your previous consent.")
+	}
+
+	var described []models.OAuthScope
+	for _, scope := range models.OAuthScopes {
+		if slices.Contains(scopes, scope.Name) {
+			described = append(described, scope)
+		}
+	}
+
+	return c.Render("oauth/consent", fiber.Map{
+		"Title":     "Authorize " + client.Name,
+		"Client":    client.ToResponse(),
+		"Email":     currentUser.Email,
+		"Scopes":    described,
+		"Request":   req,
+		"CSRFToken": middleware.CSRFToken(c),
+	})
+}
+
+// Decide handles the consent form: it records the grant and redirects back to the client
+// with an authorization code, or with access_denied when the user declined
+func (h *OAuthHandler) Decide(c *fiber.Ctx) error {
+	var req models.OAuthAuthorizeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return h.renderError(c, "The authorization request is malformed.")
+	}
+
+	client, scopes, failure := h.checkAuthorizeRequest(&req)
+	if failure != nil {
+		return h.authorizeFailure(c, &req, client, *failure)
+	}
+
+	if c.FormValue("decision") != "approve" {
+		return h.redirectError(c, &req, oauthError{"access_denied", "The user denied the request"})
+	}
+
+	currentUser := middleware.CurrentUser(c)
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var consent models.OAuthConsent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND client_id = ?", currentUser.UserID, client.ClientID).First(&consent).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(&models.OAuthConsent{
+				UserID:   currentUser.UserID,
+				ClientID: client.ClientID,
+				Scope:    strings.Join(scopes, " "),
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		granted := strings.Fields(consent.Scope)
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				granted = append(granted, scope)
+			}
+		}
+		return tx.Model(&consent).Update("scope", strings.Join(granted, " ")).Error
+	})
+	if err != nil {
+		return h.redirectError(c, &req, oauthError{"server_error", "Failed to record consent"})
+	}
+
+	return h.issueCode(c, &req, currentUser.UserID, scopes)
+}
+
+// Token issues access tokens for the authorization_code and client_credentials grants (RFC 6749, section 5).
+// No refresh tokens are issued; clients repeat the authorization when their access token expires.
+func (h *OAuthHandler) Token(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+		return tokenEndpointError(c, fiber.StatusUnauthorized, oauthError{"invalid_client", "Client authentication failed"})
+	}
+
+	grantType := c.FormValue("grant_type")
+	if grantType != models.GrantTypeAuthorizationCode && grantType != models.GrantTypeClientCredentials {
+		return tokenEndpointError(c, fiber.StatusBadRequest, oauthError{"unsupported_grant_type", "Unsupported grant type"})
+	}
+	if !client.AllowsGrantType(grantType) {
+		return tokenEndpointError(c, fiber.StatusBadRequest, oauthError{"unauthorized_client", "The client may not use this grant type"})
+	}
+
+	var user *models.User
+	var scopes []string
+	var code *models.OAuthAuthorizationCode
+
+	switch grantType {
+	case models.GrantTypeAuthorizationCode:
+		var failure *oauthError
+		code, failure = h.checkCode(c, client)
+		if failure != nil {
+			return tokenEndpointError(c, fiber.StatusBadRequest, *failure)
+		}
+
+		user = &models.User{}
+		if err := h.db.Where("id = ? AND active = ?", code.UserID, true).First(user).Error; err != nil {
+			return tokenEndpointError(c, fiber.StatusBadRequest, oauthError{"invalid_grant", "The user is no longer active"})
+		}
+		scopes = strings.Fields(code.Scope)
+
+	case models.GrantTypeClientCredentials:
+		// Public clients cannot keep a secret, so they cannot act on their own behalf
+		if client.Public {
+			return tokenEndpointError(c, fiber.StatusBadRequest, oauthError{"unauthorized_client", "Public clients cannot use the client credentials grant"})
+		}
+
+		var ok bool
+		scopes, ok = requestedScopes(client, c.FormValue("scope"))
+		if !ok {
+			return tokenEndpointError(c, fiber.StatusBadRequest, oauthError{"invalid_scope", "The requested scope is not allowed for this client"})
+		}
+	}
+
+	scope := strings.Join(scopes, " ")
+	accessToken, claims, err := h.tokens.GenerateOAuthJWT(user, client.ClientID, scope)
+	if err != nil {
+		return tokenEndpointError(c, fiber.StatusInternalServerError, oauthError{"server_error", "Failed to generate token"})
+	}
+
+	if code != nil {
+		if failure := h.redeemCode(code, claims); failure != nil {
+			return tokenEndpointError(c, fiber.StatusBadRequest, *failure)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(h.config.AccessTokenTTL.Seconds()),
+		"scope":        scope,
+	})
+}
+
+// Introspect reports whether an access token issued to an OAuth client is active (RFC 7662).
+// Only confidential clients, such as resource servers, may introspect tokens.
+func (h *OAuthHandler) Introspect(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	client, err := h.authenticateClient(c)
+	if err != nil || client.Public {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+		return tokenEndpointError(c, fiber.StatusUnauthorized, oauthError{"invalid_client", "Client authentication failed"})
+	}
+
+	claims, err := h.tokens.ParseJWT(c.FormValue("token"))
+	// First-party session tokens are never disclosed to third parties
+	if err != nil || claims.ClientID == "" || h.revocations.IsTokenRevoked(claims) {
+		return c.JSON(fiber.Map{"active": false})
+	}
+
+	response := fiber.Map{
+		"active":     true,
+		"scope":      claims.Scope,
+		"client_id":  claims.ClientID,
+		"token_type": "Bearer",
+		"sub":        claims.Subject,
+		"iss":        claims.Issuer,
+		"aud":        claims.Audience,
+		"jti":        claims.ID,
+		"exp":        claims.ExpiresAt.Unix(),
+		"iat":        claims.IssuedAt.Unix(),
+		"nbf":        claims.NotBefore.Unix(),
+	}
+	if claims.UserID != 0 {
+		response["username"] = claims.Email
+	}
+
+	return c.JSON(response)
+}
+
+// Revoke revokes an access token issued to the calling client (RFC 7009).
+// The response is the same whether or not the token was valid, so it reveals nothing about the token.
+func (h *OAuthHandler) Revoke(c *fiber.Ctx) error {
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+		return tokenEndpointError(c, fiber.StatusUnauthorized, oauthError{"invalid_client", "Client authentication failed"})
+	}
+
+	claims, err := h.tokens.ParseJWT(c.FormValue("token"))
+	if err == nil && claims.ClientID == client.ClientID {
+		if err := h.revocations.RevokeToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+			return tokenEndpointError(c, fiber.StatusServiceUnavailable, oauthError{"server_error", "Failed to revoke token"})
+		}
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// UserInfo returns the claims the access token's scopes grant access to
+func (h *OAuthHandler) UserInfo(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+	if currentUser.UserID == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Token was not issued on behalf of a user",
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	scopes := strings.Fields(currentUser.Scope)
+	info := fiber.Map{
+		"sub": currentUser.Subject,
+	}
+	if slices.Contains(scopes, "profile") {
+		info["first_name"] = user.FirstName
+		info["last_name"] = user.LastName
+		info["role"] = user.Role
+	}
+	if slices.Contains(scopes, "email") {
+		info["email"] = user.Email
+		info["email_verified"] = user.EmailVerifiedAt != nil
+	}
+
+	return c.JSON(info)
+}
+
+// GetClients lists the registered OAuth clients (admin only)
+func (h *OAuthHandler) GetClients(c *fiber.Ctx) error {
+	var clients []models.OAuthClient
+	if err := h.db.Order("created_at").Find(&clients).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch clients",
+		})
+	}
+
+	responses := make([]models.OAuthClientResponse, len(clients))
+	for i := range clients {
+		responses[i] = clients[i].ToResponse()
+	}
+
+	return c.JSON(fiber.Map{
+		"clients": responses,
+	})
+}
+
+// CreateClient registers an OAuth client (admin only).
+// The secret of a confidential client is returned once and only its hash is stored.
+func (h *OAuthHandler) CreateClient(c *fiber.Ctx) error {
+	var req models.CreateOAuthClientRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	if slices.Contains(req.GrantTypes, models.GrantTypeAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one redirect URI is required for the authorization code grant",
+		})
+	}
+	if req.Public && slices.Contains(req.GrantTypes, models.GrantTypeClientCredentials) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Public clients cannot use the client credentials grant",
+		})
+	}
+
+	client := models.OAuthClient{
+		ClientID:     uuid.NewString(),
+		Name:         req.Name,
+		Public:       req.Public,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		GrantTypes:   strings.Join(req.GrantTypes, " "),
+		Scopes:       strings.Join(req.Scopes, " "),
+		Active:       true,
+	}
+
+	var secret string
+	if !req.Public {
+		var err error
+		secret, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate client secret",
+			})
+		}
+		client.ClientSecretHash = utils.HashToken(secret)
+	}
+
+	if err := h.db.Create(&client).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create client",
+		})
+	}
+
+	response := client.ToResponse()
+	response.ClientSecret = secret
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Client created successfully. Store the secret now, it will not be shown again",
+		"client":  response,
+	})
+}
+
+// DeleteClient removes an OAuth client together with its codes and consents (admin only).
+// Access tokens already issued to it stay valid until they expire.
+func (h *OAuthHandler) DeleteClient(c *fiber.Ctx) error {
+	result := h.db.Where("client_id = ?", c.Params("client_id")).Delete(&models.OAuthClient{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete client",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Client not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Client deleted successfully",
+	})
+}
+
+// GetConsents lists the clients the current user has authorized
+func (h *OAuthHandler) GetConsents(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var consents []models.OAuthConsent
+	if err := h.db.Where("user_id = ?", currentUser.UserID).Order("created_at").Find(&consents).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch authorized applications",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"consents": consents,
+	})
+}
+
+// DeleteConsent withdraws the current user's consent for a client, so it has to ask again
+func (h *OAuthHandler) DeleteConsent(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	result := h.db.Where("user_id = ? AND client_id = ?", currentUser.UserID, c.Params("client_id")).Delete(&models.OAuthConsent{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke access",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Authorized application not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Access revoked successfully",
+	})
+}
+
+// checkAuthorizeRequest validates an authorization request and returns the client and the requested scopes.
+// The client is nil when it is unknown or the redirect URI is not registered for it.
+func (h *OAuthHandler) checkAuthorizeRequest(req *models.OAuthAuthorizeRequest) (*models.OAuthClient, []string, *oauthError) {
+	var client models.OAuthClient
+	if err := h.db.Where("client_id = ? AND active = ?", req.ClientID, true).First(&client).Error; err != nil {
+		return nil, nil, &oauthError{"invalid_client", "The application requesting access is not registered."}
+	}
+	if !client.AllowsRedirectURI(req.RedirectURI) {
+		return nil, nil, &oauthError{"invalid_request", "The application supplied a redirect address that is not registered."}
+	}
+
+	if req.ResponseType != "code" {
+		return &client, nil, &oauthError{"unsupported_response_type", "Only the code response type is supported"}
+	}
+	if !client.AllowsGrantType(models.GrantTypeAuthorizationCode) {
+		return &client, nil, &oauthError{"unauthorized_client", "The client may not use the authorization code grant"}
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return &client, nil, &oauthError{"invalid_request", "PKCE with the S256 method is required"}
+	}
+
+	scopes, ok := requestedScopes(&client, req.Scope)
+	if !ok {
+		return &client, nil, &oauthError{"invalid_scope", "The requested scope is not allowed for this client"}
+	}
+
+	return &client, scopes, nil
+}
+
+// authorizeFailure reports an invalid authorization request. Without a known client and registered
+// redirect URI the error is shown to the user, because redirecting to an unverified URI would make
+// this server an open redirector; other errors go back to the client.
+func (h *OAuthHandler) authorizeFailure(c *fiber.Ctx, req *models.OAuthAuthorizeRequest, client *models.OAuthClient, failure oauthError) error {
+	if client == nil {
+		return h.renderError(c, failure.Description)
+	}
+	return h.redirectError(c, req, failure)
+}
+
+// issueCode stores a single-use authorization code and sends the browser back to the client with it
+func (h *OAuthHandler) issueCode(c *fiber.Ctx, req *models.OAuthAuthorizeRequest, userID uint, scopes []string) error {
+	code, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return h.redirectError(c, req, oauthError{"server_error", "Failed to issue authorization code"})
+	}
+
+	err = h.db.Create(&models.OAuthAuthorizationCode{
+		CodeHash:      utils.HashToken(code),
+		ClientID:      req.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(scopes, " "),
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(oauthCodeTTL),
+	}).Error
+	if err != nil {
+		return h.redirectError(c, req, oauthError{"server_error", "Failed to issue authorization code"})
+	}
+
+	return h.redirectToClient(c, req, url.Values{"code": {code}})
+}
+
+// checkCode finds an authorization code and checks it against the token request without using it up.
+// A code that was already redeemed is a sign that it leaked, so the token issued for it is revoked
+// (RFC 6749, section 4.1.2).
+func (h *OAuthHandler) checkCode(c *fiber.Ctx, client *models.OAuthClient) (*models.OAuthAuthorizationCode, *oauthError) {
+	invalidGrant := &oauthError{"invalid_grant", "The authorization code is invalid or expired"}
+
+	var code models.OAuthAuthorizationCode
+	if err := h.db.Where("code_hash = ?", utils.HashToken(c.FormValue("code"))).First(&code).Error; err != nil {
+		return nil, invalidGrant
+	}
+
+	if code.UsedAt != nil {
+		h.revokeCodeToken(&code)
+		return nil, invalidGrant
+	}
+
+	if time.Now().After(code.ExpiresAt) || code.ClientID != client.ClientID || code.RedirectURI != c.FormValue("redirect_uri") {
+		return nil, invalidGrant
+	}
+
+	verifier := c.FormValue("code_verifier")
+	if verifier == "" || subtle.ConstantTimeCompare([]byte(oidc.CodeChallenge(verifier)), []byte(code.CodeChallenge)) != 1 {
+		return nil, invalidGrant
+	}
+
+	return &code, nil
+}
+
+// redeemCode marks a checked authorization code as used and records the access token issued for it.
+// The conditional update makes redemption atomic, so a code can't be exchanged twice concurrently.
+func (h *OAuthHandler) redeemCode(code *models.OAuthAuthorizationCode, claims *models.JWTCustomClaims) *oauthError {
+	result := h.db.Model(&models.OAuthAuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", code.ID).
+		Updates(map[string]interface{}{
+			"used_at":          time.Now(),
+			"token_jti":        claims.ID,
+			"token_expires_at": claims.ExpiresAt.Time,
+		})
+	if result.Error != nil {
+		return &oauthError{"server_error", "Failed to redeem authorization code"}
+	}
+
+	if result.RowsAffected == 0 {
+		// A concurrent request redeemed the code first
+		if err := h.db.First(code, code.ID).Error; err == nil {
+			h.revokeCodeToken(code)
+		}
+		return &oauthError{"invalid_grant", "The authorization code is invalid or expired"}
+	}
+
+	return nil
+}
+
+// revokeCodeToken revokes the access token issued for an authorization code, if any
+func (h *OAuthHandler) revokeCodeToken(code *models.OAuthAuthorizationCode) {
+	if code.TokenJTI == nil || code.TokenExpiresAt == nil {
+		return
+	}
+
+	if err := h.revocations.RevokeToken(*code.TokenJTI, code.UserID, *code.TokenExpiresAt); err != nil {
+		log.Printf("Failed to revoke token issued for reused authorization code %d: %v", code.ID, err)
+		return
+	}
+	log.Printf("Authorization code %d was reused; revoked the token issued for it", code.ID)
+}
+
+// authenticateClient identifies the client calling a back-channel endpoint from HTTP Basic
+// credentials or the client_id and client_secret form fields. Public clients only send their ID.
+func (h *OAuthHandler) authenticateClient(c *fiber.Ctx) (*models.OAuthClient, error) {
+	clientID, secret := c.FormValue("client_id"), c.FormValue("client_secret")
+	if username, password, ok := utils.ParseBasicAuth(c.Get(fiber.HeaderAuthorization)); ok {
+		clientID, secret = username, password
+	}
+	if clientID == "" {
+		return nil, errInvalidClient
+	}
+
+	var client models.OAuthClient
+	if err := h.db.Where("client_id = ? AND active = ?", clientID, true).First(&client).Error; err != nil {
+		return nil, errInvalidClient
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, errInvalidClient
+		}
+		return &client, nil
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.ClientSecretHash)) != 1 {
+		return nil, errInvalidClient
+	}
+
+	return &client, nil
+}
+
+// redirectError sends an authorization error back to the client's redirect URI
+func (h *OAuthHandler) redirectError(c *fiber.Ctx, req *models.OAuthAuthorizeRequest, failure oauthError) error {
+	return h.redirectToClient(c, req, url.Values{
+		"error":             {failure.Code},
+		"error_description": {failure.Description},
+	})
+}
+
+// redirectToClient redirects to the already verified redirect URI, echoing the client's state
+func (h *OAuthHandler) redirectToClient(c *fiber.Ctx, req *models.OAuthAuthorizeRequest, params url.Values) error {
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return h.renderError(c, "The application's redirect address is invalid.")
+	}
+
+	query := redirect.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	redirect.RawQuery = query.Encode()
+
+	return c.Redirect(redirect.String())
+}
+
+// renderError shows an authorization error to the user instead of returning to the client
+func (h *OAuthHandler) renderError(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusBadRequest).Render("oauth/consent", fiber.Map{
+		"Title": "Authorization Error",
+		"Error": message,
+	})
+}
+
+// requestedScopes parses a scope parameter and checks it against the client's registered scopes.
+// An empty parameter requests every scope registered for the client.
+func requestedScopes(client *models.OAuthClient, scope string) ([]string, bool) {
+	allowed := strings.Fields(client.Scopes)
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, true
+	}
+
+	slices.Sort(requested)
+	requested = slices.Compact(requested)
+	return requested, isSubset(requested, allowed)
+}
+
+// isSubset reports whether every element of subset is contained in set
+func isSubset(subset, set []string) bool {
+	for _, item := range subset {
+		if !slices.Contains(set, item) {
+			return false
+		}
+	}
+	return true
+}
+
+func tokenEndpointError(c *fiber.Ctx, status int, failure oauthError) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error":             failure.Code,
+		"error_description": failure.Description,
+	})
+}
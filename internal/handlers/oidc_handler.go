@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/internal/oidc"
+	"golang-base/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcStateCookie holds the encrypted state of a login in progress
+	oidcStateCookie = "oidc_state"
+
+	// oidcLoginTTL is how long the user has to complete the login at the provider
+	oidcLoginTTL = 10 * time.Minute
+)
+
+var (
+	errOIDCAccountExists = errors.New("account exists and cannot be linked")
+	errOIDCSignupClosed  = errors.New("signup through the identity provider is disabled")
+	errOIDCNoEmail       = errors.New("identity has no email")
+)
+
+type OIDCHandler struct {
+	db     *gorm.DB
+	config *config.Config
+	tokens *auth.TokenIssuer
+	guard  *auth.LoginGuard
+	cipher *auth.Cipher
+	client *oidc.Client
+}
+
+func NewOIDCHandler(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, guard *auth.LoginGuard, cipher *auth.Cipher, client *oidc.Client) *OIDCHandler {
+	return &OIDCHandler{
+		db:     db,
+		config: cfg,
+		tokens: tokens,
+		guard:  guard,
+		cipher: cipher,
+		client: client,
+	}
+}
+
+// Login redirects the browser to the identity provider to start an authorization code flow with PKCE
+func (h *OIDCHandler) Login(c *fiber.Ctx) error {
+	if !h.client.Enabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Single sign-on is not configured",
+		})
+	}
+
+	state, err := oidc.NewLoginState(oidcLoginTTL)
+	if err != nil {
+		log.Println("OIDC login state creation failed:", err)
+		return h.fail(c, loginErrorFailed)
+	}
+	state.ReturnTo = safeRedirectPath(c.Query("next"))
+
+	authURL, err := h.client.AuthCodeURL(c.UserContext(), state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		log.Println("OIDC discovery failed:", err)
+		return h.fail(c, loginErrorSSOUnavailable)
+	}
+
+	sealed, err := state.Seal(h.cipher)
+	if err != nil {
+		log.Println("OIDC login state creation failed:", err)
+		return h.fail(c, loginErrorFailed)
+	}
+
+	// SameSite=Lax lets the cookie through on the provider's top-level redirect back to us
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    sealed,
+		Path:     "/api/v1/auth/oidc",
+		Expires:  state.ExpiresAt,
+		Secure:   h.config.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return c.Redirect(authURL)
+}
+
+// Callback completes the authorization code flow: it checks the state, redeems the code,
+// validates the ID token and signs in the linked, matched or newly provisioned user
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	sealed := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/v1/auth/oidc",
+		Expires:  time.Unix(0, 0),
+		Secure:   h.config.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	if providerError := c.Query("error"); providerError != "" {
+		log.Printf("OIDC provider returned error %q: %q", providerError, c.Query("error_description"))
+		return h.fail(c, loginErrorSSOCancelled)
+	}
+
+	state, err := oidc.OpenLoginState(h.cipher, sealed)
+	if err != nil || c.Query("state") == "" || c.Query("state") != state.State {
+		return h.fail(c, loginErrorSSOExpired)
+	}
+
+	claims, err := h.client.Exchange(c.UserContext(), c.Query("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Println("OIDC code exchange failed:", err)
+		return h.fail(c, loginErrorSSOUnverified)
+	}
+
+	user, err := h.resolveUser(claims)
+	switch {
+	case errors.Is(err, errOIDCAccountExists):
+		return h.fail(c, loginErrorAccountExists)
+	case errors.Is(err, errOIDCSignupClosed):
+		return h.fail(c, loginErrorNoLinkedAccount)
+	case errors.Is(err, errOIDCNoEmail):
+		return h.fail(c, loginErrorNoEmail)
+	case err != nil:
+		log.Println("OIDC user resolution failed:", err)
+		return h.fail(c, loginErrorFailed)
+	}
+
+	if !user.Active {
+		return h.fail(c, loginErrorAccountDisabled)
+	}
+
+	if lockout := h.guard.Check(user); lockout != nil && lockout.Code == auth.LockoutCodeLocked {
+		return h.fail(c, loginErrorAccountLocked)
+	}
+
+	if h.config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return h.fail(c, loginErrorEmailNotVerified)
+	}
+
+	// Second factors enforced by this application still apply after single sign-on
+	mfaMethods, mfaRequired, err := mfaStatus(h.db, user)
+	if err != nil {
+		log.Println("OIDC login MFA check failed:", err)
+		return h.fail(c, loginErrorFailed)
+	}
+	if mfaRequired {
+		challenge, err := h.tokens.GenerateMFAChallenge(user, len(mfaMethods) == 0)
+		if err != nil {
+			log.Println("OIDC login MFA challenge failed:", err)
+			return h.fail(c, loginErrorFailed)
+		}
+
+		fragment := url.Values{
+			"mfa_token":               {challenge},
+			"mfa_enrollment_required": {strconv.FormatBool(len(mfaMethods) == 0)},
+			"mfa_methods":             {strings.Join(mfaMethods, " ")},
+		}
+		return c.Redirect("/login?next=" + url.QueryEscape(safeRedirectPath(state.ReturnTo)) + "#" + fragment.Encode())
+	}
+
+	if err := h.guard.RecordSuccess(user); err != nil {
+		log.Println("OIDC login attempt recording failed:", err)
+		return h.fail(c, loginErrorFailed)
+	}
+
+	tokens, err := h.tokens.StartSession(h.db, user, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		log.Println("OIDC login session creation failed:", err)
+		return h.fail(c, loginErrorFailed)
+	}
+
+	middleware.SetSessionCookies(c, h.config, tokens)
+	return c.Redirect(safeRedirectPath(state.ReturnTo))
+}
+
+// GetIdentities lists the external identities linked to the current user
+func (h *OIDCHandler) GetIdentities(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var identities []models.UserIdentity
+	if err := h.db.Where("user_id = ?", currentUser.UserID).Order("created_at").Find(&identities).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch identities",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"identities": identities,
+	})
+}
+
+// DeleteIdentity unlinks an external identity from the current user
+func (h *OIDCHandler) DeleteIdentity(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	result := h.db.Where("id = ? AND user_id = ?", c.Params("id"), currentUser.UserID).Delete(&models.UserIdentity{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlink identity",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Identity not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Identity unlinked successfully",
+	})
+}
+
+// resolveUser finds the user for an external identity. It follows an existing link,
+// links an existing account whose email the provider has verified, or provisions a new user.
+func (h *OIDCHandler) resolveUser(claims *oidc.IDTokenClaims) (*models.User, error) {
+	var user models.User
+	now := time.Now()
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", claims.Issuer, claims.Subject).First(&identity).Error
+		if err == nil {
+			if err := tx.Model(&identity).Updates(map[string]interface{}{"last_login_at": now, "email": email}).Error; err != nil {
+				return err
+			}
+			return tx.Where("id = ?", identity.UserID).First(&user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if email == "" {
+			return errOIDCNoEmail
+		}
+
+		err = tx.Where("LOWER(email) = ?", email).First(&user).Error
+		switch {
+		case err == nil:
+			// Only link when the provider vouches for the address; otherwise anyone
+			// registering that email at the provider could take over the account
+			if !h.config.OIDCLinkByEmail || !bool(claims.EmailVerified) {
+				return errOIDCAccountExists
+			}
+			if user.EmailVerifiedAt == nil {
+				if err := tx.Model(&user).Update("email_verified_at", now).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if !h.config.OIDCAllowSignup {
+				return errOIDCSignupClosed
+			}
+			if err := h.provisionUser(tx, &user, claims, email, now); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    claims.Issuer,
+			Subject:     claims.Subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// provisionUser creates a user just in time from the provider's claims.
+// The account gets an unusable random password; a password can be set later through a password reset.
+func (h *OIDCHandler) provisionUser(tx *gorm.DB, user *models.User, claims *oidc.IDTokenClaims, email string, now time.Time) error {
+	password, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BCryptCost)
+	if err != nil {
+		return err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+
+	*user = models.User{
+		Email:     email,
+		Password:  string(hashedPassword),
+		FirstName: firstName,
+		LastName:  lastName,
+		Role:      "user",
+		Active:    true,
+	}
+	if claims.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+
+	return tx.Create(user).Error
+}
+
+// fail ends the browser flow on the login page with one of the login error codes
+func (h *OIDCHandler) fail(c *fiber.Ctx, code string) error {
+	return c.Redirect("/login?error=" + url.QueryEscape(code))
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// organizationSlugPattern restricts slugs to DNS labels, so they can be used as subdomains
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+type OrganizationHandler struct {
+	db       *gorm.DB
+	config   *config.Config
+	validate *validator.Validate
+	tokens   *auth.TokenIssuer
+	access   *auth.AccessControl
+}
+
+func NewOrganizationHandler(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, access *auth.AccessControl) *OrganizationHandler {
+	return &OrganizationHandler{
+		db:       db,
+		config:   cfg,
+		validate: validator.New(),
+		tokens:   tokens,
+		access:   access,
+	}
+}
+
+// GetMyOrganizations lists the organizations the current user is a member of
+func (h *OrganizationHandler) GetMyOrganizations(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var memberships []models.Membership
+	if err := h.db.Preload("Organization").Where("user_id = ?", currentUser.UserID).Order("created_at").Find(&memberships).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch organizations",
+		})
+	}
+
+	current := middleware.CurrentTenant(c)
+	responses := make([]models.OrganizationResponse, len(memberships))
+	for i, membership := range memberships {
+		responses[i] = membership.Organization.ToResponse()
+		responses[i].Role = membership.Role
+		responses[i].Current = current != nil && current.OrganizationID == membership.OrganizationID
+	}
+
+	return c.JSON(fiber.Map{
+		"organizations": responses,
+	})
+}
+
+// SwitchOrganization selects the organization the current session works in. The new
+// access token and every token refreshed from the session carry it in the "org" claim.
+func (h *OrganizationHandler) SwitchOrganization(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var req models.SwitchOrganizationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var organization *models.Organization
+	if req.Organization != "" {
+		organization = &models.Organization{}
+		if err := h.db.Where("slug = ?", strings.ToLower(req.Organization)).First(organization).Error; err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Not a member of this organization",
+			})
+		}
+
+		var memberships int64
+		if err := h.db.Model(&models.Membership{}).
+			Where("organization_id = ? AND user_id = ?", organization.ID, currentUser.UserID).
+			Count(&memberships).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to switch organization",
+			})
+		}
+		if memberships == 0 && !currentUser.HasRole(models.RoleAdmin) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Not a member of this organization",
+			})
+		}
+	}
+
+	var organizationID uint
+	if organization != nil {
+		organizationID = organization.ID
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := h.db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ?", currentUser.SessionID, currentUser.UserID).
+		Update("organization_id", nullableID(organizationID)).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to switch organization",
+		})
+	}
+
+	token, err := h.tokens.GenerateJWT(&user, currentUser.SessionID, organizationID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	if middleware.FromSessionCookie(c) {
+		middleware.SetAccessTokenCookie(c, h.config, token)
+	}
+	response := fiber.Map{
+		"message":      "Organization switched successfully",
+		"token":        token,
+		"organization": nil,
+	}
+	if organization != nil {
+		response["organization"] = organization.ToResponse()
+	}
+	return c.JSON(response)
+}
+
+// GetOrganizations lists organizations (organizations:manage). Within an organization
+// only that organization is listed.
+func (h *OrganizationHandler) GetOrganizations(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	var organizations []models.Organization
+	if err := h.db.WithContext(c.UserContext()).Order("name").
+		Offset((page - 1) * limit).Limit(limit).Find(&organizations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch organizations",
+		})
+	}
+
+	responses := make([]models.OrganizationResponse, len(organizations))
+	for i := range organizations {
+		responses[i] = organizations[i].ToResponse()
+	}
+
+	return c.JSON(fiber.Map{
+		"organizations": responses,
+		"page":          page,
+		"limit":         limit,
+	})
+}
+
+// CreateOrganization creates an organization (organizations:manage)
+func (h *OrganizationHandler) CreateOrganization(c *fiber.Ctx) error {
+	var req models.CreateOrganizationRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	req.Slug = strings.ToLower(req.Slug)
+	if !organizationSlugPattern.MatchString(req.Slug) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Slugs may only contain lowercase letters, digits and '-', and cannot start or end with '-'",
+		})
+	}
+
+	var existing int64
+	if err := h.db.Model(&models.Organization{}).Where("slug = ?", req.Slug).Count(&existing).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create organization",
+		})
+	}
+	if existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Organization already exists",
+		})
+	}
+
+	organization := models.Organization{
+		Name: strings.TrimSpace(req.Name),
+		Slug: req.Slug,
+	}
+	if err := h.db.Create(&organization).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create organization",
+		})
+	}
+
+	if err := recordAudit(c, h.db, models.AuditActionOrganizationCreate, 0, "organization="+organization.Slug); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":      "Organization created successfully",
+		"organization": organization.ToResponse(),
+	})
+}
+
+// DeleteOrganization deletes an organization and its memberships (organizations:manage).
+// Users stay; sessions working in the organization leave it.
+func (h *OrganizationHandler) DeleteOrganization(c *fiber.Ctx) error {
+	organization, err := h.findOrganization(c)
+	if err != nil {
+		return h.organizationError(c, err)
+	}
+
+	if err := h.db.Delete(organization).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete organization",
+		})
+	}
+	h.access.InvalidateAll()
+
+	if err := recordAudit(c, h.db, models.AuditActionOrganizationDelete, 0, "organization="+organization.Slug); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Organization deleted successfully",
+	})
+}
+
+// GetMembers lists the members of an organization with their membership roles (organizations:manage)
+func (h *OrganizationHandler) GetMembers(c *fiber.Ctx) error {
+	organization, err := h.findOrganization(c)
+	if err != nil {
+		return h.organizationError(c, err)
+	}
+
+	var memberships []models.Membership
+	if err := h.db.WithContext(c.UserContext()).Preload("User").
+		Where("organization_id = ?", organization.ID).Order("created_at").Find(&memberships).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch members",
+		})
+	}
+
+	members := make([]models.MemberResponse, len(memberships))
+	for i := range memberships {
+		members[i] = memberships[i].ToMemberResponse()
+	}
+
+	return c.JSON(fiber.Map{
+		"organization": organization.ToResponse(),
+		"members":      members,
+	})
+}
+
+// SetMember adds a user to an organization or changes their membership role (organizations:manage).
+// The admin role cannot be a membership role, as it would reach beyond the organization.
+func (h *OrganizationHandler) SetMember(c *fiber.Ctx) error {
+	var req models.MembershipRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	organization, err := h.findOrganization(c)
+	if err != nil {
+		return h.organizationError(c, err)
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", c.Params("user_id")).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if req.Role == models.RoleAdmin {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The admin role cannot be given within an organization",
+		})
+	}
+	var roles int64
+	if err := h.db.Model(&models.Role{}).Where("name = ?", req.Role).Count(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update membership",
+		})
+	}
+	if roles == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown role: " + req.Role,
+		})
+	}
+
+	membership := models.Membership{OrganizationID: organization.ID, UserID: user.ID}
+	status := fiber.StatusOK
+	err = h.db.Where(&membership).First(&membership).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		membership.Role = req.Role
+		err = h.db.Create(&membership).Error
+		status = fiber.StatusCreated
+	case err == nil:
+		err = h.db.Model(&membership).Update("role", req.Role).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update membership",
+		})
+	}
+	h.access.Invalidate(user.ID)
+
+	details := fmt.Sprintf("organization=%s role=%s", organization.Slug, req.Role)
+	if err := recordOrganizationAudit(c, h.db, organization.ID, models.AuditActionMembershipUpdate, user.ID, details); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	membership.User = user
+	return c.Status(status).JSON(fiber.Map{
+		"message": "Membership updated successfully",
+		"member":  membership.ToMemberResponse(),
+	})
+}
+
+// RemoveMember removes a user from an organization (organizations:manage). Their sessions
+// working in the organization leave it.
+func (h *OrganizationHandler) RemoveMember(c *fiber.Ctx) error {
+	organization, err := h.findOrganization(c)
+	if err != nil {
+		return h.organizationError(c, err)
+	}
+
+	userID := c.Params("user_id")
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("organization_id = ? AND user_id = ?", organization.ID, userID).Delete(&models.Membership{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND organization_id = ?", userID, organization.ID).
+			Update("organization_id", nil).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Membership not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to remove member",
+		})
+	}
+
+	memberID, _ := strconv.ParseUint(userID, 10, 64)
+	h.access.Invalidate(uint(memberID))
+
+	if err := recordOrganizationAudit(c, h.db, organization.ID, models.AuditActionMembershipDelete, uint(memberID), "organization="+organization.Slug); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Member removed successfully",
+	})
+}
+
+// findOrganization loads the organization named by the id route parameter, within the
+// request's organization
+func (h *OrganizationHandler) findOrganization(c *fiber.Ctx) (*models.Organization, error) {
+	var organization models.Organization
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", c.Params("id")).First(&organization).Error; err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+// organizationError answers a failed organization lookup
+func (h *OrganizationHandler) organizationError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Organization not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to fetch organization",
+	})
+}
+
+// nullableID returns nil for a zero ID, so it is stored as NULL
+func nullableID(id uint) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
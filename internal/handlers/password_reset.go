@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/mailer"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const passwordResetPurpose = "password-reset"
+
+// ForgotPassword emails a password reset link.
+// The response never reveals whether the email belongs to an account.
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req models.ForgotPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ? AND active = ?", req.Email, true).First(&user).Error; err == nil {
+		if err := h.sendPasswordResetEmail(c, &user); err != nil {
+			log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user out everywhere
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req models.ResetPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	if !auth.VerifySignedToken(h.config.JWTSecret, passwordResetPurpose, req.Token) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+		})
+	}
+
+	var stored models.PasswordResetToken
+	if err := h.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.Token), time.Now()).
+		First(&stored).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), h.config.BCryptCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to hash password",
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// Consume every outstanding reset token of the user, including this one
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", stored.UserID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		// Deactivated accounts cannot reset their password
+		result = tx.Model(&models.User{}).
+			Where("id = ? AND active = ?", stored.UserID, true).
+			Update("password", string(hashedPassword))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return h.revocations.RevokeAllForUser(tx, stored.UserID)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset password",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password reset successfully. Please login with your new password",
+	})
+}
+
+// sendPasswordResetEmail stores a new reset token and mails the reset link
+func (h *AuthHandler) sendPasswordResetEmail(c *fiber.Ctx, user *models.User) error {
+	token, err := auth.NewSignedToken(h.config.JWTSecret, passwordResetPurpose)
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.Create(&models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(h.config.PasswordResetTTL),
+	}).Error; err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.config.AppBaseURL, token)
+	return h.mailer.Send(c.UserContext(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s\n\n"+
+			"The link expires in %s and can only be used once. If you did not request a reset, you can ignore this email.\n",
+			user.FirstName, link, h.config.PasswordResetTTL),
+	})
+}
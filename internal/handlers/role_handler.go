@@ -0,0 +1,483 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang-base/internal/account"
+	"golang-base/internal/auth"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// roleNamePattern restricts role names to lowercase identifiers, as they appear in URLs and policies
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// unknownNameError is returned when a request names a role or permission that does not exist
+type unknownNameError struct {
+	kind string
+	name string
+}
+
+func (e *unknownNameError) Error() string {
+	return fmt.Sprintf("unknown %s %q", e.kind, e.name)
+}
+
+// ungrantedPermissionError is returned when roles would grant a permission the caller does not hold
+type ungrantedPermissionError struct {
+	permission string
+}
+
+func (e *ungrantedPermissionError) Error() string {
+	return fmt.Sprintf("the roles grant permission %q the caller does not hold", e.permission)
+}
+
+type RoleHandler struct {
+	db       *gorm.DB
+	validate *validator.Validate
+	access   *auth.AccessControl
+}
+
+func NewRoleHandler(db *gorm.DB, access *auth.AccessControl) *RoleHandler {
+	return &RoleHandler{
+		db:       db,
+		validate: validator.New(),
+		access:   access,
+	}
+}
+
+// GetPermissions lists every permission that roles can be granted (admin only)
+func (h *RoleHandler) GetPermissions(c *fiber.Ctx) error {
+	var permissions []models.Permission
+	if err := h.db.Order("name").Find(&permissions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch permissions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"permissions": permissions,
+	})
+}
+
+// GetRoles lists every role with its permissions (admin only)
+func (h *RoleHandler) GetRoles(c *fiber.Ctx) error {
+	var roles []models.Role
+	if err := h.db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch roles",
+		})
+	}
+
+	responses := make([]models.RoleResponse, len(roles))
+	for i := range roles {
+		responses[i] = roles[i].ToResponse()
+	}
+
+	return c.JSON(fiber.Map{
+		"roles": responses,
+	})
+}
+
+// CreateRole creates a role with a set of permissions (admin only)
+func (h *RoleHandler) CreateRole(c *fiber.Ctx) error {
+	var req models.CreateRoleRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	if !roleNamePattern.MatchString(req.Name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Role names must start with a lowercase letter and contain only lowercase letters, digits, '_' and '-'",
+		})
+	}
+
+	var existing int64
+	if err := h.db.Model(&models.Role{}).Where("name = ?", req.Name).Count(&existing).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create role",
+		})
+	}
+	if existing > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Role already exists",
+		})
+	}
+
+	permissions, err := h.findPermissions(req.Permissions)
+	if err != nil {
+		return h.roleError(c, err, "Failed to create role")
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		Permissions: permissions,
+	}
+	if err := h.db.Create(&role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create role",
+		})
+	}
+
+	if err := recordAudit(c, h.db, models.AuditActionRoleCreate, 0, describeRole(&role)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Role created successfully",
+		"role":    role.ToResponse(),
+	})
+}
+
+// UpdateRole replaces a role's description and permissions (admin only).
+// The admin role always holds every permission, so its permissions cannot be changed.
+func (h *RoleHandler) UpdateRole(c *fiber.Ctx) error {
+	var req models.UpdateRoleRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var role models.Role
+	if err := h.db.Where("name = ?", c.Params("name")).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Role not found",
+		})
+	}
+
+	if role.Name == models.RoleAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "The admin role always holds every permission",
+		})
+	}
+
+	permissions, err := h.findPermissions(req.Permissions)
+	if err != nil {
+		return h.roleError(c, err, "Failed to update role")
+	}
+
+	role.Description = strings.TrimSpace(req.Description)
+	role.Permissions = permissions
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions").Save(&role).Error; err != nil {
+			return err
+		}
+		return tx.Model(&role).Association("Permissions").Replace(permissions)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update role",
+		})
+	}
+	h.access.InvalidateAll()
+
+	if err := recordAudit(c, h.db, models.AuditActionRoleUpdate, 0, describeRole(&role)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Role updated successfully",
+		"role":    role.ToResponse(),
+	})
+}
+
+// DeleteRole deletes a role that is no user's primary role (admin only).
+// Built-in roles cannot be deleted; additional assignments of the role are removed with it.
+func (h *RoleHandler) DeleteRole(c *fiber.Ctx) error {
+	var role models.Role
+	if err := h.db.Where("name = ?", c.Params("name")).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Role not found",
+		})
+	}
+
+	if role.BuiltIn {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Built-in roles cannot be deleted",
+		})
+	}
+
+	var primaryUsers int64
+	if err := h.db.Model(&models.User{}).Where("role = ?", role.Name).Count(&primaryUsers).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete role",
+		})
+	}
+	if primaryUsers > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("The role is the primary role of %d users; assign them another role first", primaryUsers),
+		})
+	}
+
+	var memberships int64
+	if err := h.db.Model(&models.Membership{}).Where("role = ?", role.Name).Count(&memberships).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete role",
+		})
+	}
+	if memberships > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("The role is the membership role of %d organization members; change it first", memberships),
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", role.ID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete role",
+		})
+	}
+	h.access.InvalidateAll()
+
+	if err := recordAudit(c, h.db, models.AuditActionRoleDelete, 0, "role="+role.Name); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Role deleted successfully",
+	})
+}
+
+// GetUserRoles lists a user's roles and the permissions they grant (admin only)
+func (h *RoleHandler) GetUserRoles(c *fiber.Ctx) error {
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", c.Params("id")).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	grants, err := h.access.Grants(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch roles",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"primary_role": user.Role,
+		"roles":        grants.Assigned,
+		"all_roles":    grants.Roles,
+		"permissions":  grants.Permissions,
+	})
+}
+
+// SetUserRoles replaces every role of a user (admin only).
+// Admins cannot take the admin role away from themselves, so there is always a way back in.
+// Like invitations, the roles may only grant permissions the caller holds, and the admin
+// role cannot be given within an organization.
+func (h *RoleHandler) SetUserRoles(c *fiber.Ctx) error {
+	var req models.UserRolesRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", c.Params("id")).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	currentUser := middleware.CurrentUser(c)
+	if user.ID == currentUser.UserID && currentUser.HasRole(models.RoleAdmin) && !slices.Contains(req.Roles, models.RoleAdmin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You cannot remove the admin role from yourself",
+		})
+	}
+
+	roles, err := h.findRoles(req.Roles)
+	if err != nil {
+		return h.roleError(c, err, "Failed to update roles")
+	}
+	if err := checkGrantable(c, h.access, req.Roles); err != nil {
+		return grantError(c, err, "Failed to update roles")
+	}
+
+	if !slices.Contains(req.Roles, user.Role) {
+		user.Role = req.Roles[0]
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("role", user.Role).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if role.Name == user.Role {
+				continue
+			}
+			if err := tx.Create(&models.UserRole{UserID: user.ID, RoleID: role.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update roles",
+		})
+	}
+	h.access.Invalidate(user.ID)
+
+	grants, err := h.access.Grants(user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch roles",
+		})
+	}
+
+	if err := recordAudit(c, h.db, models.AuditActionUserRoles, user.ID, "roles="+strings.Join(grants.Assigned, ",")); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":      "Roles updated successfully",
+		"primary_role": user.Role,
+		"roles":        grants.Assigned,
+		"all_roles":    grants.Roles,
+		"permissions":  grants.Permissions,
+	})
+}
+
+// findPermissions loads permissions by name, failing if any of them does not exist
+func (h *RoleHandler) findPermissions(names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+
+	if err := h.db.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(permissions, func(p models.Permission) bool { return p.Name == name }) {
+			return nil, &unknownNameError{kind: "permission", name: name}
+		}
+	}
+	return permissions, nil
+}
+
+// findRoles loads roles by name, failing if any of them does not exist
+func (h *RoleHandler) findRoles(names []string) ([]models.Role, error) {
+	var roles []models.Role
+	if err := h.db.Where("name IN ?", names).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(roles, func(r models.Role) bool { return r.Name == name }) {
+			return nil, &unknownNameError{kind: "role", name: name}
+		}
+	}
+	return roles, nil
+}
+
+// roleError responds to a failed role or permission lookup
+func (h *RoleHandler) roleError(c *fiber.Ctx, err error, message string) error {
+	var unknown *unknownNameError
+	if errors.As(err, &unknown) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Unknown %s: %s", unknown.kind, unknown.name),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// checkGrantable verifies that the caller may hand out roles: the roles must not grant
+// permissions the caller does not hold, and within an organization the admin role, which
+// reaches beyond it, cannot be given at all
+func checkGrantable(c *fiber.Ctx, access *auth.AccessControl, roles []string) error {
+	if middleware.CurrentTenant(c) != nil && slices.Contains(roles, models.RoleAdmin) {
+		return account.ErrAdminMembership
+	}
+
+	grants, err := access.RoleGrants(roles)
+	if err != nil {
+		return err
+	}
+	currentUser := middleware.CurrentUser(c)
+	for _, permission := range grants.Permissions {
+		if !currentUser.HasPermission(permission) {
+			return &ungrantedPermissionError{permission: permission}
+		}
+	}
+	return nil
+}
+
+// grantError responds to roles the caller may not hand out
+func grantError(c *fiber.Ctx, err error, message string) error {
+	var ungranted *ungrantedPermissionError
+	switch {
+	case errors.Is(err, account.ErrAdminMembership):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The admin role cannot be given within an organization",
+		})
+	case errors.As(err, &ungranted):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "The role grants permissions you do not hold: " + ungranted.permission,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// describeRole summarizes a role and its permissions for the audit log
+func describeRole(role *models.Role) string {
+	return fmt.Sprintf("role=%s permissions=%s", role.Name, strings.Join(role.ToResponse().Permissions, ","))
+}
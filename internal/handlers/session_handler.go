@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type SessionHandler struct {
+	db          *gorm.DB
+	config      *config.Config
+	revocations *auth.RevocationList
+}
+
+func NewSessionHandler(db *gorm.DB, cfg *config.Config, revocations *auth.RevocationList) *SessionHandler {
+	return &SessionHandler{
+		db:          db,
+		config:      cfg,
+		revocations: revocations,
+	}
+}
+
+// GetSessions lists the devices the current user is signed in on
+func (h *SessionHandler) GetSessions(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+	return h.listSessions(c, currentUser.UserID, currentUser.SessionID)
+}
+
+// RevokeSession signs the current user out on one device. Revoking the current
+// session also clears the session cookies, like logging out.
+func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	if err := h.endSession(currentUser.UserID, c.Params("id")); err != nil {
+		return h.sessionError(c, err)
+	}
+
+	if c.Params("id") == currentUser.SessionID {
+		middleware.ClearSessionCookies(c, h.config)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions signs the current user out on every device except this one
+func (h *SessionHandler) RevokeOtherSessions(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	count, err := h.endAllSessions(currentUser.UserID, currentUser.SessionID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Other sessions revoked successfully",
+		"revoked": count,
+	})
+}
+
+// GetUserSessions lists the devices a user is signed in on (admin only)
+func (h *SessionHandler) GetUserSessions(c *fiber.Ctx) error {
+	user, err := h.findUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return h.listSessions(c, user.ID, middleware.CurrentUser(c).SessionID)
+}
+
+// RevokeUserSession signs a user out on one device (admin only)
+func (h *SessionHandler) RevokeUserSession(c *fiber.Ctx) error {
+	user, err := h.findUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := h.endSession(user.ID, c.Params("session_id")); err != nil {
+		return h.sessionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeUserSessions signs a user out on every device (admin only)
+func (h *SessionHandler) RevokeUserSessions(c *fiber.Ctx) error {
+	user, err := h.findUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	count, err := h.endAllSessions(user.ID, "")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Sessions revoked successfully",
+		"revoked": count,
+	})
+}
+
+// listSessions responds with the active sessions of a user, most recently seen first
+func (h *SessionHandler) listSessions(c *fiber.Ctx, userID uint, currentSessionID string) error {
+	var sessions []models.Session
+	if err := h.activeSessions(userID).Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch sessions",
+		})
+	}
+
+	responses := make([]models.SessionResponse, len(sessions))
+	for i := range sessions {
+		responses[i] = sessions[i].ToResponse(currentSessionID)
+	}
+
+	return c.JSON(fiber.Map{
+		"sessions": responses,
+	})
+}
+
+// endSession revokes one active session of a user, including its access tokens
+func (h *SessionHandler) endSession(userID uint, sessionID string) error {
+	var session models.Session
+	if err := h.activeSessions(userID).Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return err
+	}
+
+	return h.revocations.EndSession(h.db, userID, session.ID, h.accessTokenExpiry())
+}
+
+// endAllSessions revokes every active session of a user except keepSessionID
+// and returns how many were revoked
+func (h *SessionHandler) endAllSessions(userID uint, keepSessionID string) (int, error) {
+	var sessionIDs []string
+	query := h.activeSessions(userID)
+	if keepSessionID != "" {
+		query = query.Where("id <> ?", keepSessionID)
+	}
+	if err := query.Pluck("id", &sessionIDs).Error; err != nil {
+		return 0, err
+	}
+
+	expiry := h.accessTokenExpiry()
+	for _, sessionID := range sessionIDs {
+		if err := h.revocations.EndSession(h.db, userID, sessionID, expiry); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(sessionIDs), nil
+}
+
+// activeSessions scopes a query to the sessions of a user that can still be refreshed
+func (h *SessionHandler) activeSessions(userID uint) *gorm.DB {
+	return h.db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now())
+}
+
+// accessTokenExpiry is the latest time an access token issued so far can still be accepted
+func (h *SessionHandler) accessTokenExpiry() time.Time {
+	return time.Now().Add(h.config.AccessTokenTTL + h.config.JWTLeeway)
+}
+
+// findUser loads the user named by the id route parameter, within the request's organization
+func (h *SessionHandler) findUser(c *fiber.Ctx) (*models.User, error) {
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", c.Params("id")).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// sessionError responds to a failed session lookup or revocation
+func (h *SessionHandler) sessionError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to revoke session",
+	})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// stubQuery answers every query whose SQL contains match with the given rows
+type stubQuery struct {
+	match   string
+	columns []string
+	rows    [][]any
+}
+
+var (
+	stubMu      sync.Mutex
+	stubQueries = map[string][]stubQuery{}
+)
+
+func init() {
+	sql.Register("handlers-stub", stubDriver{})
+}
+
+// openStubDB opens a database that answers queries from canned results, so handlers can be
+// exercised without a running Postgres. Statements that match nothing fail the test.
+func openStubDB(t *testing.T, queries []stubQuery) *gorm.DB {
+	t.Helper()
+
+	stubMu.Lock()
+	stubQueries[t.Name()] = queries
+	stubMu.Unlock()
+	t.Cleanup(func() {
+		stubMu.Lock()
+		delete(stubQueries, t.Name())
+		stubMu.Unlock()
+	})
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DriverName: "handlers-stub", DSN: t.Name()}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type stubDriver struct{}
+
+func (stubDriver) Open(name string) (driver.Conn, error) {
+	stubMu.Lock()
+	defer stubMu.Unlock()
+	return &stubConn{queries: stubQueries[name]}, nil
+}
+
+type stubConn struct {
+	queries []stubQuery
+}
+
+func (c *stubConn) Prepare(query string) (driver.Stmt, error) {
+	return &stubStmt{conn: c, query: query}, nil
+}
+
+func (c *stubConn) Close() error { return nil }
+
+func (c *stubConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("stub database does not support transactions")
+}
+
+type stubStmt struct {
+	conn  *stubConn
+	query string
+}
+
+func (s *stubStmt) Close() error  { return nil }
+func (s *stubStmt) NumInput() int { return -1 }
+
+func (s *stubStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("unexpected statement: %s", s.query)
+}
+
+func (s *stubStmt) Query(args []driver.Value) (driver.Rows, error) {
+	for _, q := range s.conn.queries {
+		if strings.Contains(s.query, q.match) {
+			return &stubRows{columns: q.columns, rows: q.rows}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected query: %s", s.query)
+}
+
+type stubRows struct {
+	columns []string
+	rows    [][]any
+	next    int
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	for i, v := range r.rows[r.next] {
+		dest[i] = v
+	}
+	r.next++
+	return nil
+}
@@ -3,54 +3,76 @@ package handlers
 import (
 	"strconv"
 
+	"golang-base/internal/account"
+	"golang-base/internal/auth"
 	"golang-base/internal/config"
+	"golang-base/internal/middleware"
 	"golang-base/internal/models"
+	"golang-base/internal/policy"
 	"golang-base/pkg/utils"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type UserHandler struct {
-	db       *gorm.DB
-	config   *config.Config
-	validate *validator.Validate
+	db          *gorm.DB
+	config      *config.Config
+	validate    *validator.Validate
+	tokens      *auth.TokenIssuer
+	revocations *auth.RevocationList
+	access      *auth.AccessControl
+	policies    *policy.Engine
+	accounts    *account.Service
 }
 
-func NewUserHandler(db *gorm.DB, cfg *config.Config) *UserHandler {
+func NewUserHandler(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, revocations *auth.RevocationList, access *auth.AccessControl, policies *policy.Engine) *UserHandler {
 	return &UserHandler{
-		db:       db,
-		config:   cfg,
-		validate: validator.New(),
+		db:          db,
+		config:      cfg,
+		validate:    validator.New(),
+		tokens:      tokens,
+		revocations: revocations,
+		access:      access,
+		policies:    policies,
+		accounts:    account.NewService(db, cfg),
 	}
 }
 
 // GetProfile returns the current user's profile
 func (h *UserHandler) GetProfile(c *fiber.Ctx) error {
-	userID := c.Locals("user_id")
-	if userID == nil {
+	currentUser := middleware.CurrentUser(c)
+	if currentUser == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "User not authenticated",
 		})
 	}
 
 	var user models.User
-	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"user": user.ToResponse(),
-	})
+	response := fiber.Map{
+		"user":        user.ToResponse(),
+		"roles":       currentUser.Roles,
+		"permissions": currentUser.Permissions,
+	}
+	if currentUser.Impersonating() {
+		response["impersonator"] = currentUser.Actor
+	}
+
+	return c.JSON(response)
 }
 
 // UpdateProfile updates the current user's profile
 func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
-	userID := c.Locals("user_id")
-	if userID == nil {
+	currentUser := middleware.CurrentUser(c)
+	if currentUser == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "User not authenticated",
 		})
@@ -74,7 +96,7 @@ func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
@@ -95,16 +117,94 @@ func (h *UserHandler) UpdateProfile(c *fiber.Ctx) error {
 	})
 }
 
+// ChangePassword changes the current user's password and signs out their other sessions
+func (h *UserHandler) ChangePassword(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+	if currentUser == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User not authenticated",
+		})
+	}
+
+	var req models.ChangePasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	// Check current password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Current password is incorrect",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), h.config.BCryptCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to hash password",
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+
+		if err := h.revocations.RevokeOtherSessions(tx, user.ID, currentUser.SessionID); err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", user.ID).First(&user).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to change password",
+		})
+	}
+
+	// The current access token carries the old token version, so replace it
+	token, err := h.tokens.GenerateJWT(&user, currentUser.SessionID, currentUser.OrganizationID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	if middleware.FromSessionCookie(c) {
+		middleware.SetAccessTokenCookie(c, h.config, token)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Password changed successfully",
+		"token":   token,
+	})
+}
+
 // DeleteProfile deletes the current user's account
 func (h *UserHandler) DeleteProfile(c *fiber.Ctx) error {
-	userID := c.Locals("user_id")
-	if userID == nil {
+	currentUser := middleware.CurrentUser(c)
+	if currentUser == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "User not authenticated",
 		})
 	}
 
-	if err := h.db.Delete(&models.User{}, userID).Error; err != nil {
+	if err := h.db.Delete(&models.User{}, currentUser.UserID).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete user",
 		})
@@ -115,38 +215,63 @@ func (h *UserHandler) DeleteProfile(c *fiber.Ctx) error {
 	})
 }
 
-// GetAllUsers returns all users (admin only)
+// GetAllUsers returns all users, or the members of the request's organization (users:read).
+// See userQuery for the filters, search and sort order it takes besides page and limit.
 func (h *UserHandler) GetAllUsers(c *fiber.Ctx) error {
 	var users []models.User
 
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
 	offset := (page - 1) * limit
 
-	if err := h.db.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+	query, err := h.userQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch users",
 		})
 	}
 
-	var userResponses []models.UserResponse
-	for _, user := range users {
-		userResponses = append(userResponses, user.ToResponse())
+	if err := query.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch users",
+		})
+	}
+
+	userResponses := make([]models.UserResponse, len(users))
+	for i := range users {
+		userResponses[i] = users[i].ToResponse()
 	}
 
+	pages := totalPages(total, limit)
 	return c.JSON(fiber.Map{
-		"users": userResponses,
-		"page":  page,
-		"limit": limit,
+		"users":       userResponses,
+		"page":        page,
+		"limit":       limit,
+		"total":       total,
+		"total_pages": pages,
+		"links":       pageLinks(c, page, pages),
 	})
 }
 
-// GetUserByID returns a specific user by ID (admin only)
+// GetUserByID returns a specific user by ID (the user themselves or users:read)
 func (h *UserHandler) GetUserByID(c *fiber.Ctx) error {
 	userID := c.Params("id")
 
 	var user models.User
-	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", userID).First(&user).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
@@ -157,15 +282,17 @@ func (h *UserHandler) GetUserByID(c *fiber.Ctx) error {
 	})
 }
 
-// UpdateUser updates a specific user (admin only)
+// UpdateUser updates a specific user (users:write, or as allowed by policy).
+// Changing the role also requires roles:manage.
 func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
 
 	var req struct {
-		FirstName string `json:"first_name" validate:"required"`
-		LastName  string `json:"last_name" validate:"required"`
-		Role      string `json:"role" validate:"required,oneof=user admin"`
-		Active    *bool  `json:"active" validate:"required"`
+		FirstName  string  `json:"first_name" validate:"required"`
+		LastName   string  `json:"last_name" validate:"required"`
+		Role       string  `json:"role" validate:"required"`
+		Active     *bool   `json:"active" validate:"required"`
+		Department *string `json:"department" validate:"omitempty,max=100"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -181,22 +308,64 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	}
 
 	var user models.User
-	if err := h.db.Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", userID).First(&user).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
 
+	resource, err := policy.UserResource(h.db, &user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user",
+		})
+	}
+	if !h.policies.Authorize(c, models.PermissionUsersWrite, resource).Allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient permissions",
+		})
+	}
+	if req.Role != user.Role && !h.policies.Authorize(c, models.PermissionRolesManage, resource).Allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient permissions",
+		})
+	}
+
+	var roles int64
+	if err := h.db.Model(&models.Role{}).Where("name = ?", req.Role).Count(&roles).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user",
+		})
+	}
+	if roles == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown role: " + req.Role,
+		})
+	}
+
 	user.FirstName = req.FirstName
 	user.LastName = req.LastName
 	user.Role = req.Role
 	user.Active = *req.Active
+	if req.Department != nil {
+		user.Department = *req.Department
+	}
 
-	if err := h.db.Save(&user).Error; err != nil {
+	// The new primary role replaces the old one; it is no longer needed as an additional role
+	err = h.db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND role_id IN (?)", user.ID,
+			tx.Model(&models.Role{}).Select("id").Where("name = ?", user.Role)).
+			Delete(&models.UserRole{}).Error
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update user",
 		})
 	}
+	h.access.Invalidate(user.ID)
 
 	return c.JSON(fiber.Map{
 		"message": "User updated successfully",
@@ -204,11 +373,66 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	})
 }
 
-// DeleteUser deletes a specific user (admin only)
+// UnlockUser lifts a lockout and resets the failed login counter of a user (users:write, or as allowed by policy)
+func (h *UserHandler) UnlockUser(c *fiber.Ctx) error {
+	userID := c.Params("id")
+
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", userID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	resource, err := policy.UserResource(h.db, &user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlock user",
+		})
+	}
+	if !h.policies.Authorize(c, models.PermissionUsersWrite, resource).Allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient permissions",
+		})
+	}
+
+	if err := auth.UnlockAccount(h.db, user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlock user",
+		})
+	}
+	user.LockedUntil = nil
+
+	return c.JSON(fiber.Map{
+		"message": "User unlocked successfully",
+		"user":    user.ToResponse(),
+	})
+}
+
+// DeleteUser deletes a specific user (users:delete, or as allowed by policy)
 func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 	userID := c.Params("id")
 
-	if err := h.db.Delete(&models.User{}, userID).Error; err != nil {
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).Where("id = ?", userID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	resource, err := policy.UserResource(h.db, &user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete user",
+		})
+	}
+	if !h.policies.Authorize(c, models.PermissionUsersDelete, resource).Allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient permissions",
+		})
+	}
+
+	if err := h.db.WithContext(c.UserContext()).Delete(&user).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete user",
 		})
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"golang-base/internal/account"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// importFormats maps the content types and file extensions of import files to their format
+var importFormats = map[string]string{
+	"text/csv":             account.FormatCSV,
+	"application/x-ndjson": account.FormatNDJSON,
+	"application/ndjson":   account.FormatNDJSON,
+	"application/jsonl":    account.FormatNDJSON,
+	".csv":                 account.FormatCSV,
+	".ndjson":              account.FormatNDJSON,
+	".jsonl":               account.FormatNDJSON,
+}
+
+// CreateUser creates an account on behalf of a user (users:write). Giving a role other
+// than user also requires roles:manage; within an organization the new user becomes a
+// member, with the role as their membership role.
+func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
+	var req models.CreateUserRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	opts := h.accountOptions(c)
+	var user *models.User
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = h.accounts.CreateUser(tx, &req, &opts)
+		return err
+	})
+
+	var validationErrors validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrors):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	case errors.Is(err, account.ErrExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User already exists",
+		})
+	case errors.Is(err, account.ErrUnknownRole):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown role: " + req.Role,
+		})
+	case errors.Is(err, account.ErrAdminMembership):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The admin role cannot be given within an organization",
+		})
+	case errors.Is(err, account.ErrRoleNotAllowed):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient permissions",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create user",
+		})
+	}
+
+	if err := recordAudit(c, h.db, models.AuditActionUserCreate, user.ID, "role="+user.Role); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record audit log",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "User created successfully",
+		"user":    user.ToResponse(),
+	})
+}
+
+// ImportUsers creates users from a CSV or NDJSON file, sent as the request body or as the
+// "file" field of a multipart form (users:write). Rows are checked like CreateUser.
+// Query parameters: format (csv or ndjson, otherwise taken from the content type or file
+// name), dry_run, batch_size (commit every so many rows instead of all or nothing) and
+// start (the row to resume from).
+func (h *UserHandler) ImportUsers(c *fiber.Ctx) error {
+	body, name, err := importFile(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid import file",
+		})
+	}
+	defer body.Close()
+
+	format := c.Query("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+		format = importFormats[mediaType]
+		if extension := strings.ToLower(filepath.Ext(name)); name != "" {
+			format = importFormats[extension]
+		}
+	}
+
+	opts := h.accountOptions(c)
+	opts.DryRun = c.QueryBool("dry_run")
+	opts.BatchSize = c.QueryInt("batch_size")
+	opts.Start = c.QueryInt("start", 1)
+	if opts.BatchSize < 0 || opts.Start < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "batch_size and start must be positive",
+		})
+	}
+
+	result, err := h.accounts.Import(body, format, opts)
+	if errors.Is(err, account.ErrInvalidFile) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":  fmt.Sprintf("Import stopped by a database error; resume from row %d", result.NextRow),
+			"import": result,
+		})
+	}
+
+	if !result.DryRun && result.Imported > 0 {
+		details := fmt.Sprintf("rows=%d imported=%d failed=%d", result.Rows, result.Imported, result.Failed)
+		if err := recordAudit(c, h.db, models.AuditActionUserImport, 0, details); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to record audit log",
+			})
+		}
+	}
+
+	if opts.BatchSize == 0 && result.Failed > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"error":  fmt.Sprintf("No users were imported because %d rows are invalid", result.Failed),
+			"import": result,
+		})
+	}
+
+	message := "Users imported successfully"
+	if result.DryRun {
+		message = "Dry run completed; no users were created"
+	}
+	return c.JSON(fiber.Map{
+		"message": message,
+		"import":  result,
+	})
+}
+
+// accountOptions returns how the current user may create accounts
+func (h *UserHandler) accountOptions(c *fiber.Ctx) account.Options {
+	opts := account.Options{
+		AllowRoles: middleware.CurrentUser(c).HasPermission(models.PermissionRolesManage),
+	}
+	if current := middleware.CurrentTenant(c); current != nil {
+		opts.OrganizationID = &current.OrganizationID
+	}
+	return opts
+}
+
+// importFile returns the uploaded file of a multipart request, or else the request body,
+// along with the file name if there is one
+func importFile(c *fiber.Ctx) (io.ReadCloser, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if mediaType != fiber.MIMEMultipartForm {
+		return io.NopCloser(bytes.NewReader(c.Body())), "", nil
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	return file, header.Filename, nil
+}
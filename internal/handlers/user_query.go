@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-base/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// User search expressions. They must stay identical to the indexes created by the
+// add_user_search_indexes migration, or searches fall back to scanning the table.
+const (
+	userFullName     = "(users.first_name || ' ' || users.last_name)"
+	userSearchVector = "to_tsvector('simple', users.first_name || ' ' || users.last_name || ' ' || users.email)"
+)
+
+// userSortColumns are the fields the user listing can be sorted by
+var userSortColumns = map[string]string{
+	"id":         "users.id",
+	"email":      "users.email",
+	"first_name": "users.first_name",
+	"last_name":  "users.last_name",
+	"role":       "users.role",
+	"active":     "users.active",
+	"department": "users.department",
+	"created_at": "users.created_at",
+	"updated_at": "users.updated_at",
+}
+
+// userQuery selects the users the admin listing shows, before paging. Exports use it
+// as well, so that they contain exactly the users the listing would. Query parameters:
+//
+//	role          users holding any of these comma-separated roles, primary or assigned
+//	active        true or false
+//	created_from  created at or after this RFC 3339 time or date
+//	created_to    created before this time, or on or before this date
+//	q             search in names and email addresses, by word or part of one
+//	sort          comma-separated fields, descending with a leading "-"; by default by
+//	              relevance when searching, otherwise by id
+//
+// Invalid parameters are returned as an error whose message suits the client.
+func (h *UserHandler) userQuery(c *fiber.Ctx) (*gorm.DB, error) {
+	query := h.db.WithContext(c.UserContext()).Model(&models.User{})
+
+	if roles := splitList(c.Query("role")); len(roles) > 0 {
+		query = query.Where("(users.role IN ? OR users.id IN (?))", roles,
+			h.db.Table("user_roles").Select("user_roles.user_id").
+				Joins("JOIN roles ON roles.id = user_roles.role_id").
+				Where("roles.name IN ?", roles))
+	}
+
+	if value := c.Query("active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("active must be true or false")
+		}
+		query = query.Where("users.active = ?", active)
+	}
+
+	if value := c.Query("created_from"); value != "" {
+		from, _, err := parseTimeOrDate(value)
+		if err != nil {
+			return nil, errors.New("created_from must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		query = query.Where("users.created_at >= ?", from)
+	}
+	if value := c.Query("created_to"); value != "" {
+		to, date, err := parseTimeOrDate(value)
+		if err != nil {
+			return nil, errors.New("created_to must be an RFC 3339 time or a YYYY-MM-DD date")
+		}
+		// A date includes the whole day
+		if date {
+			to = to.AddDate(0, 0, 1)
+		}
+		query = query.Where("users.created_at < ?", to)
+	}
+
+	search := strings.TrimSpace(c.Query("q"))
+	if search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		query = query.Where(
+			"("+userSearchVector+" @@ websearch_to_tsquery('simple', ?) OR "+userFullName+" ILIKE ? OR users.email ILIKE ?)",
+			search, pattern, pattern)
+	}
+
+	order, err := userOrder(c.Query("sort"), search)
+	if err != nil {
+		return nil, err
+	}
+	return query.Order(order), nil
+}
+
+// userOrder builds the ORDER BY of the user listing, ending with the ID so that pages
+// never overlap
+func userOrder(sort, search string) (clause.OrderBy, error) {
+	var columns []string
+	var vars []any
+	sorted := map[string]bool{}
+	for _, field := range splitList(sort) {
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			field, direction = field[1:], "DESC"
+		}
+		column, ok := userSortColumns[field]
+		if !ok {
+			return clause.OrderBy{}, fmt.Errorf("cannot sort by %q", field)
+		}
+		if sorted[column] {
+			continue
+		}
+		sorted[column] = true
+		columns = append(columns, column+" "+direction)
+	}
+
+	if len(columns) == 0 && search != "" {
+		columns = append(columns, "greatest(similarity(users.email, ?), similarity("+userFullName+", ?)) DESC")
+		vars = append(vars, search, search)
+	}
+	if !sorted["users.id"] {
+		columns = append(columns, "users.id ASC")
+	}
+
+	return clause.OrderBy{Expression: clause.Expr{SQL: strings.Join(columns, ", "), Vars: vars}}, nil
+}
+
+// pageLinks returns the links of a page of the listing, keeping the other query parameters
+func pageLinks(c *fiber.Ctx, page, totalPages int) fiber.Map {
+	values, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+	link := func(page int) string {
+		values.Set("page", strconv.Itoa(page))
+		return c.Path() + "?" + values.Encode()
+	}
+
+	links := fiber.Map{
+		"self":  link(page),
+		"first": link(1),
+		"last":  link(max(totalPages, 1)),
+	}
+	if page > 1 {
+		links["prev"] = link(min(page-1, max(totalPages, 1)))
+	}
+	if page < totalPages {
+		links["next"] = link(page + 1)
+	}
+	return links
+}
+
+// totalPages returns how many pages of limit items hold total items
+func totalPages(total int64, limit int) int {
+	return int(math.Ceil(float64(total) / float64(limit)))
+}
+
+// parseTimeOrDate parses an RFC 3339 time or a date, reporting whether it was a date
+func parseTimeOrDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// splitList splits a comma-separated query parameter, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -1,13 +1,51 @@
 package handlers
 
 import (
+	"strings"
+
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+
 	"github.com/gofiber/fiber/v2"
 )
 
-type WebHandler struct{}
+// Error codes other handlers pass to the login page in the error query parameter
+const (
+	loginErrorFailed           = "login_failed"
+	loginErrorSSOUnavailable   = "sso_unavailable"
+	loginErrorSSOCancelled     = "sso_cancelled"
+	loginErrorSSOExpired       = "sso_expired"
+	loginErrorSSOUnverified    = "sso_unverified"
+	loginErrorAccountExists    = "account_exists"
+	loginErrorNoLinkedAccount  = "no_linked_account"
+	loginErrorNoEmail          = "no_email"
+	loginErrorAccountDisabled  = "account_disabled"
+	loginErrorAccountLocked    = "account_locked"
+	loginErrorEmailNotVerified = "email_not_verified"
+)
+
+// loginErrors maps login page error codes to the messages shown, so the page never
+// displays text taken from the URL. Unknown codes show no message.
+var loginErrors = map[string]string{
+	loginErrorFailed:           "Failed to sign in",
+	loginErrorSSOUnavailable:   "The identity provider is unavailable",
+	loginErrorSSOCancelled:     "Sign-in was cancelled at the identity provider",
+	loginErrorSSOExpired:       "Your sign-in session expired. Please try again",
+	loginErrorSSOUnverified:    "Could not verify your identity with the provider",
+	loginErrorAccountExists:    "An account with this email already exists. Sign in with your password first",
+	loginErrorNoLinkedAccount:  "No account is linked to this identity",
+	loginErrorNoEmail:          "The identity provider did not share an email address",
+	loginErrorAccountDisabled:  "This account has been deactivated",
+	loginErrorAccountLocked:    "This account is temporarily locked",
+	loginErrorEmailNotVerified: "Please verify your email address before logging in",
+}
+
+type WebHandler struct {
+	config *config.Config
+}
 
-func NewWebHandler() *WebHandler {
-	return &WebHandler{}
+func NewWebHandler(cfg *config.Config) *WebHandler {
+	return &WebHandler{config: cfg}
 }
 
 // Index serves the homepage
@@ -20,7 +58,11 @@ func (h *WebHandler) Index(c *fiber.Ctx) error {
 // Login serves the login page
 func (h *WebHandler) Login(c *fiber.Ctx) error {
 	return c.Render("auth/login", fiber.Map{
-		"Title": "Login",
+		"Title":           "Login",
+		"Error":           loginErrors[c.Query("error")],
+		"Next":            safeRedirectPath(c.Query("next")),
+		"SSOEnabled":      h.config.OIDCEnabled(),
+		"SSOProviderName": h.config.OIDCProviderName,
 	})
 }
 
@@ -31,9 +73,58 @@ func (h *WebHandler) Register(c *fiber.Ctx) error {
 	})
 }
 
+// VerifyEmail serves the email verification page opened from the verification link
+func (h *WebHandler) VerifyEmail(c *fiber.Ctx) error {
+	return c.Render("auth/verify_email", fiber.Map{
+		"Title": "Verify Email",
+		"Token": c.Query("token"),
+	})
+}
+
+// ForgotPassword serves the page for requesting a password reset email
+func (h *WebHandler) ForgotPassword(c *fiber.Ctx) error {
+	return c.Render("auth/forgot_password", fiber.Map{
+		"Title": "Forgot Password",
+	})
+}
+
+// ResetPassword serves the page for choosing a new password from a reset link
+func (h *WebHandler) ResetPassword(c *fiber.Ctx) error {
+	return c.Render("auth/reset_password", fiber.Map{
+		"Title": "Reset Password",
+		"Token": c.Query("token"),
+	})
+}
+
+// MagicLink serves the page for requesting a login link, and for logging in when opened from one
+func (h *WebHandler) MagicLink(c *fiber.Ctx) error {
+	return c.Render("auth/magic_link", fiber.Map{
+		"Title": "Email Login Link",
+		"Token": c.Query("token"),
+	})
+}
+
+// Invitation serves the page for accepting or declining an invitation link
+func (h *WebHandler) Invitation(c *fiber.Ctx) error {
+	return c.Render("auth/invitation", fiber.Map{
+		"Title": "Accept Invitation",
+		"Token": c.Query("token"),
+	})
+}
+
 // Dashboard serves the user dashboard
 func (h *WebHandler) Dashboard(c *fiber.Ctx) error {
 	return c.Render("dashboard", fiber.Map{
-		"Title": "Dashboard",
+		"Title":     "Dashboard",
+		"CSRFToken": middleware.CSRFToken(c),
 	})
 }
+
+// safeRedirectPath returns path if it stays on this site and the dashboard otherwise,
+// so the login page can't be used to redirect users to another site
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/dashboard"
+	}
+	return path
+}
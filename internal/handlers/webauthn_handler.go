@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/internal/passkey"
+	"golang-base/pkg/utils"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type WebAuthnHandler struct {
+	db       *gorm.DB
+	config   *config.Config
+	validate *validator.Validate
+	tokens   *auth.TokenIssuer
+	guard    *auth.LoginGuard
+	passkeys *passkey.Service
+}
+
+func NewWebAuthnHandler(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, guard *auth.LoginGuard, passkeys *passkey.Service) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		db:       db,
+		config:   cfg,
+		validate: validator.New(),
+		tokens:   tokens,
+		guard:    guard,
+		passkeys: passkeys,
+	}
+}
+
+// RegisterBegin returns the options for navigator.credentials.create() to register a new passkey
+func (h *WebAuthnHandler) RegisterBegin(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var user models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	creation, challengeID, err := h.passkeys.BeginRegistration(&user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start passkey registration",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"challenge_id": challengeID,
+		"options":      creation,
+	})
+}
+
+// RegisterFinish verifies the authenticator's response and stores the new passkey
+func (h *WebAuthnHandler) RegisterFinish(c *fiber.Ctx) error {
+	var req models.WebAuthnRegisterRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	currentUser := middleware.CurrentUser(c)
+
+	var user models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	credential, err := h.passkeys.FinishRegistration(&user, req.ChallengeID, req.Name, req.Credential)
+	if errors.Is(err, passkey.ErrInvalidChallenge) || errors.Is(err, passkey.ErrVerificationFailed) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Passkey registration failed",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to register passkey",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message":    "Passkey registered successfully",
+		"credential": credential,
+	})
+}
+
+// GetCredentials lists the current user's passkeys
+func (h *WebAuthnHandler) GetCredentials(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var credentials []models.WebAuthnCredential
+	if err := h.db.Where("user_id = ?", currentUser.UserID).Order("created_at").Find(&credentials).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch passkeys",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"credentials": credentials,
+	})
+}
+
+// DeleteCredential removes one of the current user's passkeys. The last second factor
+// cannot be removed while the user's role requires MFA.
+func (h *WebAuthnHandler) DeleteCredential(c *fiber.Ctx) error {
+	currentUser := middleware.CurrentUser(c)
+
+	var user models.User
+	if err := h.db.Where("id = ?", currentUser.UserID).First(&user).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	var credential models.WebAuthnCredential
+	if err := h.db.Where("id = ? AND user_id = ?", c.Params("id"), user.ID).First(&credential).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Passkey not found",
+		})
+	}
+
+	if !user.MFAEnabled {
+		var remaining int64
+		if err := h.db.Model(&models.WebAuthnCredential{}).Where("user_id = ? AND id <> ?", user.ID, credential.ID).Count(&remaining).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check MFA policy",
+			})
+		}
+
+		required, err := roleRequiresMFA(h.db, &user)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check MFA policy",
+			})
+		}
+		if required && remaining == 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "MFA is required for your role; set up an authenticator app before removing your last passkey",
+			})
+		}
+	}
+
+	if err := h.db.Delete(&credential).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete passkey",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Passkey deleted successfully",
+	})
+}
+
+// LoginBegin returns the options for navigator.credentials.get() to log in with any
+// discoverable passkey, without a password
+func (h *WebAuthnHandler) LoginBegin(c *fiber.Ctx) error {
+	assertion, challengeID, err := h.passkeys.BeginLogin(nil)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start passkey login",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"challenge_id": challengeID,
+		"options":      assertion,
+	})
+}
+
+// LoginFinish verifies a passkey assertion and logs the user in. The passkey was
+// unlocked with user verification, so it counts as both factors and no MFA challenge follows.
+func (h *WebAuthnHandler) LoginFinish(c *fiber.Ctx) error {
+	var req models.WebAuthnLoginRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": utils.FormatValidationErrors(err),
+		})
+	}
+
+	user, err := h.passkeys.FinishLogin(nil, req.ChallengeID, req.Credential)
+	if errors.Is(err, passkey.ErrInvalidChallenge) || errors.Is(err, passkey.ErrVerificationFailed) || errors.Is(err, passkey.ErrClonedAuthenticator) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Passkey verification failed",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify passkey",
+		})
+	}
+
+	// Locked accounts stay locked, whichever credential is presented
+	if lockout := h.guard.Check(user); lockout != nil {
+		return lockoutResponse(c, lockout)
+	}
+
+	if h.config.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Email address not verified",
+		})
+	}
+
+	if err := h.guard.RecordSuccess(user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to record login attempt",
+		})
+	}
+
+	tokens, err := h.tokens.StartSession(h.db, user, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	middleware.SetSessionCookies(c, h.config, tokens)
+	return c.JSON(tokenResponse("Login successful", tokens, user))
+}
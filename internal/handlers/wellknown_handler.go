@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"strings"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WellKnownHandler serves discovery documents under /.well-known
+type WellKnownHandler struct {
+	config *config.Config
+	keys   *auth.KeyManager
+}
+
+// NewWellKnownHandler creates a new well-known handler
+func NewWellKnownHandler(cfg *config.Config, keys *auth.KeyManager) *WellKnownHandler {
+	return &WellKnownHandler{config: cfg, keys: keys}
+}
+
+// JWKS publishes the public keys used to verify access tokens.
+// The set is empty when tokens are signed with the shared HS256 secret.
+func (h *WellKnownHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.keys.JWKS())
+}
+
+// OAuthMetadata describes the OAuth 2.0 authorization server to clients (RFC 8414)
+func (h *WellKnownHandler) OAuthMetadata(c *fiber.Ctx) error {
+	scopes := make([]string, len(models.OAuthScopes))
+	for i, scope := range models.OAuthScopes {
+		scopes[i] = scope.Name
+	}
+
+	baseURL := strings.TrimRight(h.config.AppBaseURL, "/")
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{
+		"issuer":                                h.config.JWTIssuer,
+		"authorization_endpoint":                baseURL + "/oauth/authorize",
+		"token_endpoint":                        baseURL + "/oauth/token",
+		"introspection_endpoint":                baseURL + "/oauth/introspect",
+		"revocation_endpoint":                   baseURL + "/oauth/revoke",
+		"userinfo_endpoint":                     baseURL + "/api/v1/oauth/userinfo",
+		"jwks_uri":                              baseURL + "/.well-known/jwks.json",
+		"scopes_supported":                      scopes,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{models.GrantTypeAuthorizationCode, models.GrantTypeClientCredentials},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-base/internal/config"
+)
+
+// Message represents a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email messages
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the sender selected by the MAIL_DRIVER configuration.
+// Unknown drivers fall back to logging so that mail is never silently dropped.
+func New(cfg *config.Config) Sender {
+	switch cfg.MailDriver {
+	case "log":
+		return &LogSender{from: cfg.MailFrom}
+	case "file":
+		return &FileSender{from: cfg.MailFrom, dir: cfg.MailDir}
+	case "smtp":
+		return &SMTPSender{
+			from:     cfg.MailFrom,
+			addr:     net.JoinHostPort(cfg.MailSMTPHost, strconv.Itoa(cfg.MailSMTPPort)),
+			host:     cfg.MailSMTPHost,
+			username: cfg.MailSMTPUsername,
+			password: cfg.MailSMTPPassword,
+		}
+	default:
+		log.Printf("Warning: unknown mail driver %q, falling back to log", cfg.MailDriver)
+		return &LogSender{from: cfg.MailFrom}
+	}
+}
+
+// LogSender writes messages to the application log instead of delivering them.
+// It is intended for local development only.
+type LogSender struct {
+	from string
+}
+
+// Send logs the message
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail from=%s to=%s subject=%q\n%s", s.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender writes each message as an .eml file into a directory
+type FileSender struct {
+	from string
+	dir  string
+}
+
+// Send writes the message to a new file in the mail directory
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), sanitizeFileName(msg.To))
+	return os.WriteFile(filepath.Join(s.dir, name), []byte(format(s.from, msg)), 0o640)
+}
+
+// SMTPSender delivers messages through an SMTP server. With the defaults it talks to a
+// local mail catcher such as Mailpit or MailHog on port 1025, without authentication.
+type SMTPSender struct {
+	from     string
+	addr     string
+	host     string
+	username string
+	password string
+}
+
+// Send delivers the message, using STARTTLS when the server offers it
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	return smtp.SendMail(s.addr, auth, from.Address, []string{msg.To}, []byte(format(s.from, msg)))
+}
+
+// format renders a message with its headers in RFC 5322 layout
+func format(from string, msg Message) string {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return b.String()
+}
+
+// sanitizeFileName replaces characters that are unsafe in file names
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -1,17 +1,55 @@
 package middleware
 
 import (
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/models"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-// JWTAuth creates JWT authentication middleware
-func JWTAuth(secret string) fiber.Handler {
+// currentUserKey is the Locals key under which JWTAuth stores the token claims
+const currentUserKey = "current_user"
+
+// cookieSessionKey is the Locals key marking requests authenticated with the session cookie
+const cookieSessionKey = "cookie_session"
+
+// silentRefreshWindow is how close to expiry a cookie session's access token is renewed by WebAuth
+const silentRefreshWindow = time.Minute
+
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenRevoked = errors.New("token has been revoked")
+)
+
+// JWTAuth creates JWT authentication middleware.
+// Tokens that were revoked on logout, or that carry an outdated token version
+// after a "log out all devices", are rejected.
+// Requests without an Authorization header may authenticate with the browser's
+// session cookie instead; state-changing requests must then carry the CSRF token.
+// Scripts can send "Authorization: ApiKey <key>" instead of a JWT.
+// The user's current roles and permissions are resolved into the claims.
+func JWTAuth(tokens *auth.TokenIssuer, revocations *auth.RevocationList, apiKeys *auth.APIKeyStore, access *auth.AccessControl) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Get token from Authorization header
+		if key, ok := strings.CutPrefix(c.Get("Authorization"), "ApiKey "); ok {
+			return authenticateAPIKey(c, apiKeys, access, key)
+		}
+
+		// Get token from Authorization header, falling back to the session cookie
 		tokenString := c.Get("Authorization")
+		fromCookie := false
+		if tokenString == "" {
+			tokenString = c.Cookies(AccessTokenCookie)
+			fromCookie = tokenString != ""
+		}
 		if tokenString == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Authorization header required",
@@ -24,70 +62,340 @@ func JWTAuth(secret string) fiber.Handler {
 		}
 
 		// Parse and validate token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token signing method")
-			}
-			return []byte(secret), nil
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := verifyAccessToken(tokens, revocations, tokenString, false)
+		if errors.Is(err, errTokenRevoked) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Token has been revoked",
+			})
+		}
+		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid token",
 			})
 		}
 
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
+		if fromCookie && !verifyCSRF(c, tokens, claims.SessionID) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Invalid CSRF token",
+			})
+		}
+
+		if err := resolveGrants(access, claims); err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token claims",
+				"error": "Invalid token",
 			})
 		}
 
 		// Store user info in context
-		c.Locals("user_id", claims["user_id"])
-		c.Locals("user_email", claims["email"])
-		c.Locals("user_role", claims["role"])
+		c.Locals(currentUserKey, claims)
+		c.Locals(cookieSessionKey, fromCookie)
 
 		return c.Next()
 	}
 }
 
-// RequireRole creates role-based authorization middleware
+// authenticateAPIKey authenticates a request with an API key and enforces its scopes:
+// only keys with the write scope may make state-changing requests
+func authenticateAPIKey(c *fiber.Ctx, apiKeys *auth.APIKeyStore, access *auth.AccessControl, key string) error {
+	claims, err := apiKeys.Authenticate(key, c.IP())
+	if err == nil {
+		err = resolveGrants(access, claims)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid API key",
+		})
+	}
+
+	if !isSafeMethod(c.Method()) && !claims.HasScope(models.APIKeyScopeWrite) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API key lacks the write scope",
+		})
+	}
+
+	c.Locals(currentUserKey, claims)
+
+	return c.Next()
+}
+
+// resolveGrants adds the user's roles and permissions to the claims. Impersonation tokens
+// get the roles but no permissions, so impersonating never grants privileged access.
+func resolveGrants(access *auth.AccessControl, claims *models.JWTCustomClaims) error {
+	grants, err := access.Grants(claims.UserID)
+	if err != nil {
+		return err
+	}
+
+	claims.Role = grants.Roles[0]
+	claims.Roles = grants.Roles
+	if !claims.Impersonating() {
+		claims.Permissions = grants.Permissions
+	}
+	return nil
+}
+
+// CurrentUser returns the claims of the authenticated user, or nil when the request
+// did not pass through JWTAuth or WebAuth
+func CurrentUser(c *fiber.Ctx) *models.JWTCustomClaims {
+	claims, _ := c.Locals(currentUserKey).(*models.JWTCustomClaims)
+	return claims
+}
+
+// FromSessionCookie reports whether the request was authenticated with the browser's session
+// cookie rather than an Authorization header. Handlers that issue a new access token only
+// replace the cookie then, so bearer clients don't end up with a browser session.
+func FromSessionCookie(c *fiber.Ctx) bool {
+	fromCookie, _ := c.Locals(cookieSessionKey).(bool)
+	return fromCookie
+}
+
+// Actor returns the user who is really making the request: the admin behind an impersonation
+// token, otherwise the authenticated user. It returns nil for unauthenticated requests and
+// for OAuth clients acting on their own behalf.
+func Actor(c *fiber.Ctx) *models.ActorClaim {
+	claims := CurrentUser(c)
+	if claims == nil || claims.UserID == 0 {
+		return nil
+	}
+	if claims.Actor != nil {
+		return claims.Actor
+	}
+	return &models.ActorClaim{
+		Subject:      strconv.FormatUint(uint64(claims.UserID), 10),
+		UserID:       claims.UserID,
+		Email:        claims.Email,
+		TokenVersion: claims.TokenVersion,
+	}
+}
+
+// BlockImpersonation rejects requests made with an impersonation token. It guards actions
+// that only the real account owner may take, such as changing credentials or deleting the account.
+func BlockImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := CurrentUser(c)
+		if claims == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		if claims.Impersonating() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This action is not allowed while impersonating a user",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireRole creates role-based authorization middleware.
+// Roles are matched through the role hierarchy, so a role also passes checks for the roles it includes.
 func RequireRole(requiredRole string) fiber.Handler {
+	return RequireAnyRole(requiredRole)
+}
+
+// RequireAnyRole passes users holding at least one of the roles
+func RequireAnyRole(roles ...string) fiber.Handler {
+	return requireRoles(roles, false)
+}
+
+// RequireAllRoles passes users holding every one of the roles
+func RequireAllRoles(roles ...string) fiber.Handler {
+	return requireRoles(roles, true)
+}
+
+// requireRoles creates role-based authorization middleware requiring all or any of the roles
+func requireRoles(roles []string, all bool) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		role := c.Locals("user_role")
-		if role == nil {
+		claims := CurrentUser(c)
+		if claims == nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Authentication required",
 			})
 		}
 
-		userRole, ok := role.(string)
-		if !ok || userRole != requiredRole {
+		held := 0
+		for _, role := range roles {
+			if claims.HasRole(role) {
+				held++
+			}
+		}
+		if held == 0 || (all && held < len(roles)) {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "Insufficient permissions",
 			})
 		}
 
+		// An admin's API key only carries admin rights when it was created with the admin scope
+		if slices.Contains(roles, models.RoleAdmin) && claims.APIKeyID != 0 && !claims.HasScope(models.APIKeyScopeAdmin) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API key lacks the admin scope",
+			})
+		}
+
 		return c.Next()
 	}
 }
 
-// WebAuth creates web authentication middleware for HTML pages
-func WebAuth() fiber.Handler {
+// RequirePermission creates permission-based authorization middleware.
+// The user's roles must grant every listed permission. API keys only carry
+// permissions when they were created with the admin scope.
+func RequirePermission(permissions ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Check for JWT token in cookie
-		tokenString := c.Cookies("auth_token")
-		if tokenString == "" {
-			// Redirect to login page
-			return c.Redirect("/login")
+		claims := CurrentUser(c)
+		if claims == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		for _, permission := range permissions {
+			if !claims.HasPermission(permission) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Insufficient permissions",
+				})
+			}
+		}
+
+		if claims.APIKeyID != 0 && !claims.HasScope(models.APIKeyScopeAdmin) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API key lacks the admin scope",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireSelfOrPermission lets users act on their own account, identified by the route
+// parameter param, and users whose roles grant the permission act on any account.
+// It lets one route serve both users and admins instead of being duplicated per group.
+func RequireSelfOrPermission(param, permission string) fiber.Handler {
+	requirePermission := RequirePermission(permission)
+
+	return func(c *fiber.Ctx) error {
+		claims := CurrentUser(c)
+		if claims == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		if IsSelf(c, param) {
+			return c.Next()
+		}
+
+		return requirePermission(c)
+	}
+}
+
+// IsSelf reports whether the route parameter param names the authenticated user
+func IsSelf(c *fiber.Ctx, param string) bool {
+	claims := CurrentUser(c)
+	id, err := strconv.ParseUint(c.Params(param), 10, 64)
+	return err == nil && claims != nil && claims.UserID != 0 && uint(id) == claims.UserID
+}
+
+// RequireSession rejects requests authenticated with an API key. It guards actions that manage
+// credentials or sessions, so a leaked key can't be turned into a login or into more keys.
+func RequireSession() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := CurrentUser(c)
+		if claims == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
 		}
 
-		// For web auth, we could validate the token here
-		// For now, just continue if token exists
+		if claims.APIKeyID != 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This action requires signing in and cannot be performed with an API key",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// WebAuth creates web authentication middleware for HTML pages.
+// It validates the session cookie exactly like JWTAuth validates bearer tokens,
+// silently rotates the session when the access token is missing, expired or about
+// to expire, and requires the CSRF token on form posts.
+func WebAuth(db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, revocations *auth.RevocationList, access *auth.AccessControl) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := verifyAccessToken(tokens, revocations, c.Cookies(AccessTokenCookie), false)
+
+		if err != nil || time.Until(claims.ExpiresAt.Time) < silentRefreshWindow {
+			refreshed, refreshErr := refreshWebSession(c, db, cfg, tokens, revocations)
+			switch {
+			case refreshErr == nil:
+				claims = refreshed
+			case err != nil:
+				// Neither the access token nor the refresh token is usable
+				ClearSessionCookies(c, cfg)
+				return redirectToLogin(c)
+			}
+		}
+
+		if !verifyCSRF(c, tokens, claims.SessionID) {
+			return fiber.NewError(fiber.StatusForbidden, "Invalid CSRF token")
+		}
+
+		if err := resolveGrants(access, claims); err != nil {
+			ClearSessionCookies(c, cfg)
+			return redirectToLogin(c)
+		}
+
+		c.Locals(currentUserKey, claims)
+		c.Locals(cookieSessionKey, true)
+		c.Locals(csrfTokenKey, tokens.CSRFToken(claims.SessionID))
+
 		return c.Next()
 	}
 }
+
+// redirectToLogin sends the browser to the login page. Page requests carry their URL along,
+// so the user lands back on it after signing in.
+func redirectToLogin(c *fiber.Ctx) error {
+	if c.Method() != fiber.MethodGet {
+		return c.Redirect("/login")
+	}
+	return c.Redirect("/login?next=" + url.QueryEscape(c.OriginalURL()))
+}
+
+// refreshWebSession rotates the session's refresh token cookie and stores the new token pair
+func refreshWebSession(c *fiber.Ctx, db *gorm.DB, cfg *config.Config, tokens *auth.TokenIssuer, revocations *auth.RevocationList) (*models.JWTCustomClaims, error) {
+	refreshToken := c.Cookies(RefreshTokenCookie)
+	if refreshToken == "" {
+		return nil, auth.ErrInvalidRefreshToken
+	}
+
+	pair, _, err := tokens.RotateRefreshToken(db, refreshToken, c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		return nil, err
+	}
+
+	SetSessionCookies(c, cfg, pair)
+	return verifyAccessToken(tokens, revocations, pair.AccessToken, false)
+}
+
+// verifyAccessToken validates an access token and checks it against the revocation list.
+// Tokens issued to OAuth clients are scope-limited, so they are only accepted when oauthClient is set;
+// first-party tokens are never accepted in their place.
+func verifyAccessToken(tokens *auth.TokenIssuer, revocations *auth.RevocationList, tokenString string, oauthClient bool) (*models.JWTCustomClaims, error) {
+	if tokenString == "" {
+		return nil, errInvalidToken
+	}
+
+	claims, err := tokens.ParseJWT(tokenString)
+	if err != nil || (claims.ClientID != "") != oauthClient {
+		return nil, errInvalidToken
+	}
+
+	if revocations.IsTokenRevoked(claims) {
+		return nil, errTokenRevoked
+	}
+
+	return claims, nil
+}
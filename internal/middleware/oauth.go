@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"golang-base/internal/auth"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// OAuthAuth creates authentication middleware for resources exposed to OAuth clients.
+// It accepts only access tokens issued by the authorization server, which carry a client ID
+// and scope; combine it with RequireScope. The claims are available through CurrentUser.
+func OAuthAuth(tokens *auth.TokenIssuer, revocations *auth.RevocationList) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer ")
+		if !ok || tokenString == "" {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authorization header required",
+			})
+		}
+
+		claims, err := verifyAccessToken(tokens, revocations, tokenString, true)
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			message := "Invalid token"
+			if errors.Is(err, errTokenRevoked) {
+				message = "Token has been revoked"
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": message,
+			})
+		}
+
+		c.Locals(currentUserKey, claims)
+
+		return c.Next()
+	}
+}
+
+// RequireScope creates middleware that requires the OAuth access token to grant one of the given scopes
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := CurrentUser(c)
+		if claims == nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		for _, scope := range scopes {
+			if claims.HasScope(scope) {
+				return c.Next()
+			}
+		}
+
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient scope",
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cookies holding a browser session. The access and refresh tokens are HttpOnly;
+// the CSRF token is readable by scripts so they can echo it in a header.
+const (
+	AccessTokenCookie  = "auth_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+)
+
+// CSRF token locations checked on state-changing requests authenticated by cookie
+const (
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFFormField = "_csrf"
+)
+
+// csrfTokenKey is the Locals key under which WebAuth stores the session's CSRF token
+const csrfTokenKey = "csrf_token"
+
+// SetSessionCookies stores a freshly issued token pair in the browser's session cookies
+func SetSessionCookies(c *fiber.Ctx, cfg *config.Config, tokens *auth.TokenPair) {
+	sessionExpires := time.Now().Add(cfg.SessionTimeout)
+
+	SetAccessTokenCookie(c, cfg, tokens.AccessToken)
+	c.Cookie(sessionCookie(cfg, RefreshTokenCookie, tokens.RefreshToken, sessionExpires, true))
+	c.Cookie(sessionCookie(cfg, CSRFCookie, tokens.CSRFToken, sessionExpires, false))
+}
+
+// SetAccessTokenCookie replaces the access token of the browser session
+func SetAccessTokenCookie(c *fiber.Ctx, cfg *config.Config, accessToken string) {
+	c.Cookie(sessionCookie(cfg, AccessTokenCookie, accessToken, time.Now().Add(cfg.AccessTokenTTL), true))
+}
+
+// ClearSessionCookies removes the browser session cookies
+func ClearSessionCookies(c *fiber.Ctx, cfg *config.Config) {
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie, CSRFCookie} {
+		c.Cookie(sessionCookie(cfg, name, "", time.Unix(0, 0), name != CSRFCookie))
+	}
+}
+
+// CSRFToken returns the CSRF token of the session authenticated by WebAuth, for embedding in forms
+func CSRFToken(c *fiber.Ctx) string {
+	token, _ := c.Locals(csrfTokenKey).(string)
+	return token
+}
+
+// sessionCookie builds a session cookie with the attributes shared by all session cookies
+func sessionCookie(cfg *config.Config, name, value string, expires time.Time, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   cfg.CookieSecure,
+		HTTPOnly: httpOnly,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+}
+
+// verifyCSRF checks the CSRF token of a state-changing request against the session it claims to belong to
+func verifyCSRF(c *fiber.Ctx, tokens *auth.TokenIssuer, sessionID string) bool {
+	if isSafeMethod(c.Method()) {
+		return true
+	}
+
+	token := c.Get(CSRFHeader)
+	if token == "" {
+		token = c.FormValue(CSRFFormField)
+	}
+
+	return tokens.VerifyCSRFToken(sessionID, token)
+}
+
+// isSafeMethod reports whether an HTTP method must not change state
+func isSafeMethod(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
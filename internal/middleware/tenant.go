@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+	"golang-base/internal/tenant"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// tenantKey is the Locals key under which ResolveTenant stores the organization of the request
+const tenantKey = "tenant"
+
+// Tenant resolvers, in the order given by TENANT_RESOLVERS
+const (
+	TenantFromHeader    = "header"
+	TenantFromSubdomain = "subdomain"
+	TenantFromClaim     = "claim"
+)
+
+// ResolveTenant creates middleware that determines the organization a request is made in.
+// It must run after JWTAuth. The sources in cfg.TenantResolvers are tried in order: the
+// organization slug in the TENANT_HEADER header, the subdomain in front of TENANT_BASE_DOMAIN,
+// and the "org" claim selected for the session. The first one present decides.
+//
+// Naming an organization the user is not a member of is rejected with 403, except for
+// admins, who may work in any organization; an outdated claim is ignored. Within the
+// organization, the membership role is added to the user's roles and permissions, and the
+// request context confines queries of tenant-scoped models to the organization's rows.
+// Handlers run their queries with db.WithContext(c.UserContext()).
+func ResolveTenant(db *gorm.DB, cfg *config.Config, access *auth.AccessControl) fiber.Handler {
+	var resolvers []string
+	for _, resolver := range strings.Split(cfg.TenantResolvers, ",") {
+		if resolver = strings.TrimSpace(resolver); resolver != "" {
+			resolvers = append(resolvers, resolver)
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		claims := CurrentUser(c)
+		if claims == nil || claims.UserID == 0 {
+			return c.Next()
+		}
+
+		for _, resolver := range resolvers {
+			var query *gorm.DB
+			switch resolver {
+			case TenantFromHeader:
+				if slug := c.Get(cfg.TenantHeader); slug != "" {
+					query = db.Where("slug = ?", strings.ToLower(slug))
+				}
+			case TenantFromSubdomain:
+				if slug := subdomain(c.Hostname(), cfg.TenantBaseDomain); slug != "" {
+					query = db.Where("slug = ?", slug)
+				}
+			case TenantFromClaim:
+				if claims.OrganizationID != 0 {
+					query = db.Where("id = ?", claims.OrganizationID)
+				}
+			}
+			if query == nil {
+				continue
+			}
+
+			current, err := enterOrganization(access, claims, query)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// The session's organization was deleted or the user left it since the token was issued
+				if resolver == TenantFromClaim {
+					return c.Next()
+				}
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Not a member of this organization",
+				})
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to resolve organization",
+				})
+			}
+
+			c.Locals(tenantKey, current)
+			c.SetUserContext(tenant.WithOrganization(c.UserContext(), current.OrganizationID))
+			break
+		}
+
+		return c.Next()
+	}
+}
+
+// enterOrganization looks up the organization selected by query and adds the user's membership
+// role to the claims. It returns gorm.ErrRecordNotFound when there is no such organization or
+// the user may not work in it.
+func enterOrganization(access *auth.AccessControl, claims *models.JWTCustomClaims, query *gorm.DB) (*models.Tenant, error) {
+	var organization models.Organization
+	if err := query.First(&organization).Error; err != nil {
+		return nil, err
+	}
+	current := &models.Tenant{OrganizationID: organization.ID, Slug: organization.Slug}
+
+	grants, err := access.OrganizationGrants(claims.UserID, organization.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) && claims.HasRole(models.RoleAdmin) {
+		return current, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	current.Role = grants.OrganizationRole
+	claims.Roles = grants.Roles
+	if !claims.Impersonating() {
+		claims.Permissions = grants.Permissions
+	}
+	return current, nil
+}
+
+// ConfineToTenant guards routes that change the account named by the route parameter param.
+// Within an organization, callers holding permission only through their membership role may
+// only change accounts the organization fully controls: accounts that belong to no other
+// organization and whose own roles grant no permissions. Changing any other account, such as
+// an admin's, would reach beyond the organization. Callers whose own roles grant the
+// permission are not confined, and outside organizations nothing changes.
+func ConfineToTenant(db *gorm.DB, access *auth.AccessControl, param, permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := CurrentUser(c)
+		current := CurrentTenant(c)
+		if claims == nil || current == nil {
+			return c.Next()
+		}
+
+		own, err := access.Grants(claims.UserID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check permissions",
+			})
+		}
+		if slices.Contains(own.Permissions, permission) {
+			return c.Next()
+		}
+
+		targetID, err := strconv.ParseUint(c.Params(param), 10, 64)
+		if err != nil {
+			return c.Next()
+		}
+
+		// Accounts that don't exist are left to the handler to report
+		target, err := access.Grants(uint(targetID))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Next()
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check permissions",
+			})
+		}
+
+		var elsewhere int64
+		if err := db.Model(&models.Membership{}).
+			Where("user_id = ? AND organization_id <> ?", targetID, current.OrganizationID).
+			Count(&elsewhere).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check permissions",
+			})
+		}
+
+		if elsewhere > 0 || len(target.Permissions) > 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This account is managed outside this organization",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// subdomain returns the single label in front of the base domain, such as "acme" for
+// acme.example.com, or "" when the host is not a subdomain of it
+func subdomain(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(baseDomain))
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// CurrentTenant returns the organization the request is made in, or nil when it is made
+// outside organizations
+func CurrentTenant(c *fiber.Ctx) *models.Tenant {
+	current, _ := c.Locals(tenantKey).(*models.Tenant)
+	return current
+}
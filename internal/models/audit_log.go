@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Audit log actions
+const (
+	AuditActionImpersonationStart = "impersonation.start"
+	AuditActionImpersonationStop  = "impersonation.stop"
+	AuditActionRoleCreate         = "role.create"
+	AuditActionRoleUpdate         = "role.update"
+	AuditActionRoleDelete         = "role.delete"
+	AuditActionUserRoles          = "user.roles"
+	AuditActionOrganizationCreate = "organization.create"
+	AuditActionOrganizationDelete = "organization.delete"
+	AuditActionMembershipUpdate   = "membership.update"
+	AuditActionMembershipDelete   = "membership.delete"
+	AuditActionInvitationCreate   = "invitation.create"
+	AuditActionInvitationRevoke   = "invitation.revoke"
+	AuditActionInvitationAccept   = "invitation.accept"
+	AuditActionInvitationDecline  = "invitation.decline"
+	AuditActionUserCreate         = "user.create"
+	AuditActionUserImport         = "user.import"
+	AuditActionUserExport         = "user.export"
+)
+
+// AuditLog records a security-relevant action. ActorID is the user who performed it
+// and UserID the user it was performed on; either may be nil for system actions.
+// OrganizationID is the organization the action was performed in, if any.
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	ActorID        *uint  `gorm:"index" json:"actor_id"`
+	UserID         *uint  `gorm:"index" json:"user_id"`
+	OrganizationID *uint  `gorm:"index" json:"organization_id"`
+	Action         string `gorm:"not null;index" json:"action"`
+	Details        string `gorm:"not null;default:''" json:"details"`
+	IPAddress      string `gorm:"not null;default:''" json:"ip_address"`
+	UserAgent      string `gorm:"not null;default:''" json:"user_agent"`
+}
+
+// TenantScope limits queries within an organization to the actions performed in it
+func (AuditLog) TenantScope(organizationID uint) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: organizationID}
+}
+
+// ImpersonateRequest represents an admin's request to act as another user
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
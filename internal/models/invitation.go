@@ -0,0 +1,107 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Invitation statuses
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation represents an emailed invitation to join with a preassigned role. Invitations
+// made within an organization add the user to it with Role as the membership role; others
+// give Role to the user, as the primary role of a new account.
+type Invitation struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Email          string     `gorm:"not null;index" json:"email"`
+	Role           string     `gorm:"not null" json:"role"`
+	OrganizationID *uint      `gorm:"index" json:"organization_id,omitempty"`
+	InvitedByID    *uint      `json:"invited_by_id,omitempty"`
+	TokenHash      string     `gorm:"unique;not null" json:"-"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	DeclinedAt     *time.Time `json:"declined_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	UserID         *uint      `json:"user_id,omitempty"`
+
+	Organization *Organization `json:"-"`
+}
+
+// TenantScope limits queries within an organization to its invitations
+func (Invitation) TenantScope(organizationID uint) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: organizationID}
+}
+
+// Status returns the state of the invitation
+func (i *Invitation) Status() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.DeclinedAt != nil:
+		return InvitationDeclined
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case time.Now().After(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
+
+// InvitationResponse represents an invitation in API responses
+type InvitationResponse struct {
+	ID           uint                  `json:"id"`
+	Email        string                `json:"email"`
+	Role         string                `json:"role"`
+	Organization *OrganizationResponse `json:"organization,omitempty"`
+	InvitedByID  *uint                 `json:"invited_by_id,omitempty"`
+	Status       string                `json:"status"`
+	CreatedAt    time.Time             `json:"created_at"`
+	ExpiresAt    time.Time             `json:"expires_at"`
+}
+
+// ToResponse converts Invitation to InvitationResponse; the organization must be preloaded
+func (i *Invitation) ToResponse() InvitationResponse {
+	response := InvitationResponse{
+		ID:          i.ID,
+		Email:       i.Email,
+		Role:        i.Role,
+		InvitedByID: i.InvitedByID,
+		Status:      i.Status(),
+		CreatedAt:   i.CreatedAt,
+		ExpiresAt:   i.ExpiresAt,
+	}
+	if i.Organization != nil {
+		organization := i.Organization.ToResponse()
+		response.Organization = &organization
+	}
+	return response
+}
+
+// CreateInvitationRequest represents a request to invite someone by email
+type CreateInvitationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required"`
+}
+
+// InvitationTokenRequest identifies an invitation by the token from its link
+type InvitationTokenRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// AcceptInvitationRequest accepts an invitation. The name and password are required when
+// the invitation creates an account, and ignored when it is linked to an existing one.
+type AcceptInvitationRequest struct {
+	Token     string `json:"token" validate:"required"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt counts failed logins for an email address that matches no active account.
+// Only the SHA-256 digest of the normalized email is stored.
+type LoginAttempt struct {
+	ID                  uint       `gorm:"primarykey" json:"id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	EmailHash           string     `gorm:"not null;uniqueIndex" json:"-"`
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"failed_login_attempts"`
+	LastFailedLoginAt   *time.Time `json:"last_failed_login_at"`
+	LockedUntil         *time.Time `json:"locked_until"`
+}
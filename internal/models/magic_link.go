@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// MagicLinkToken represents a single-use token that logs a user in from an emailed link
+type MagicLinkToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"unique;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// MagicLinkRequest represents a request for a login link
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkVerifyRequest represents a request to log in with a token from a login link
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+)
+
+// Second factors a user can answer an MFA challenge with
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
+// MFARecoveryCode represents a one-time code that can replace a TOTP code when the authenticator is lost
+type MFARecoveryCode struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID   uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash string     `gorm:"not null" json:"-"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
+
+// TableName overrides the default table name
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFARolePolicy records whether users with a role must use multi-factor authentication
+type MFARolePolicy struct {
+	Role      string    `gorm:"primaryKey" json:"role"`
+	Required  bool      `gorm:"not null;default:false" json:"required"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName overrides the default table name
+func (MFARolePolicy) TableName() string {
+	return "mfa_role_policies"
+}
+
+// MFAVerifyRequest represents the second login step, answering an MFA challenge
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code"`
+}
+
+// MFAEnrollRequest represents a TOTP enrollment started from an MFA challenge during login
+type MFAEnrollRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+// MFAEnrollConfirmRequest completes an enrollment started during login
+type MFAEnrollConfirmRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// TOTPCodeRequest represents a request confirmed with a current TOTP code
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// TOTPDisableRequest represents a request to turn off TOTP
+type TOTPDisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// MFARolePolicyRequest represents an update of the MFA requirement for a role
+type MFARolePolicyRequest struct {
+	Required *bool `json:"required" validate:"required"`
+}
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// OAuth grant types supported by the authorization server
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// OAuthScope describes a scope clients can request, as shown on the consent screen
+type OAuthScope struct {
+	Name        string
+	Description string
+}
+
+// OAuthScopes lists the scopes supported by the authorization server
+var OAuthScopes = []OAuthScope{
+	{Name: "profile", Description: "See your name and role"},
+	{Name: "email", Description: "See your email address"},
+}
+
+// OAuthClient represents a third-party application registered with the authorization server.
+// Confidential clients authenticate with a secret, of which only the SHA-256 hash is stored;
+// public clients (SPAs, native apps) have no secret and must use PKCE.
+// RedirectURIs, GrantTypes and Scopes are space-separated lists.
+type OAuthClient struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ClientID         string `gorm:"unique;not null" json:"client_id"`
+	ClientSecretHash string `gorm:"not null;default:''" json:"-"`
+	Name             string `gorm:"not null" json:"name"`
+	Public           bool   `gorm:"not null;default:false" json:"public"`
+	RedirectURIs     string `gorm:"column:redirect_uris;not null;default:''" json:"-"`
+	GrantTypes       string `gorm:"not null;default:''" json:"-"`
+	Scopes           string `gorm:"not null;default:''" json:"-"`
+	Active           bool   `gorm:"not null;default:true" json:"active"`
+}
+
+// TableName overrides the default table name
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// AllowsRedirectURI reports whether uri exactly matches one of the registered redirect URIs
+func (c *OAuthClient) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(strings.Fields(c.RedirectURIs), uri)
+}
+
+// AllowsGrantType reports whether the client may use a grant type
+func (c *OAuthClient) AllowsGrantType(grantType string) bool {
+	return slices.Contains(strings.Fields(c.GrantTypes), grantType)
+}
+
+// OAuthClientResponse represents a registered client in API responses
+type OAuthClientResponse struct {
+	ID           uint      `json:"id"`
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	Public       bool      `json:"public"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types"`
+	Scopes       []string  `json:"scopes"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ToResponse converts OAuthClient to OAuthClientResponse
+func (c *OAuthClient) ToResponse() OAuthClientResponse {
+	return OAuthClientResponse{
+		ID:           c.ID,
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		Public:       c.Public,
+		RedirectURIs: strings.Fields(c.RedirectURIs),
+		GrantTypes:   strings.Fields(c.GrantTypes),
+		Scopes:       strings.Fields(c.Scopes),
+		Active:       c.Active,
+		CreatedAt:    c.CreatedAt,
+	}
+}
+
+// OAuthAuthorizationCode represents a single-use authorization code issued after the user consented.
+// Only the SHA-256 hash of the code is stored. TokenJTI identifies the access token issued for
+// the code, so it can be revoked if the code is presented again.
+type OAuthAuthorizationCode struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	CodeHash       string     `gorm:"unique;not null" json:"-"`
+	ClientID       string     `gorm:"not null;index" json:"client_id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	RedirectURI    string     `gorm:"not null" json:"redirect_uri"`
+	Scope          string     `gorm:"not null;default:''" json:"scope"`
+	CodeChallenge  string     `gorm:"not null" json:"-"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt         *time.Time `json:"used_at,omitempty"`
+	TokenJTI       *string    `gorm:"column:token_jti" json:"-"`
+	TokenExpiresAt *time.Time `json:"-"`
+}
+
+// TableName overrides the default table name
+func (OAuthAuthorizationCode) TableName() string {
+	return "oauth_authorization_codes"
+}
+
+// OAuthConsent records the scopes a user has granted to a client, so the consent screen is only shown again for new scopes
+type OAuthConsent struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID   uint   `gorm:"not null" json:"user_id"`
+	ClientID string `gorm:"not null" json:"client_id"`
+	Scope    string `gorm:"not null;default:''" json:"scope"`
+}
+
+// TableName overrides the default table name
+func (OAuthConsent) TableName() string {
+	return "oauth_consents"
+}
+
+// CreateOAuthClientRequest represents a request to register an OAuth client
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required"`
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirect_uris" validate:"dive,url"`
+	GrantTypes   []string `json:"grant_types" validate:"required,min=1,dive,oneof=authorization_code client_credentials"`
+	Scopes       []string `json:"scopes" validate:"dive,oneof=profile email"`
+}
+
+// OAuthAuthorizeRequest represents the parameters of an authorization request (RFC 6749, section 4.1.1, with RFC 7636 PKCE)
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `query:"response_type" form:"response_type"`
+	ClientID            string `query:"client_id" form:"client_id"`
+	RedirectURI         string `query:"redirect_uri" form:"redirect_uri"`
+	Scope               string `query:"scope" form:"scope"`
+	State               string `query:"state" form:"state"`
+	CodeChallenge       string `query:"code_challenge" form:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method" form:"code_challenge_method"`
+}
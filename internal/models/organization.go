@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// Organization represents a customer company. Users belong to organizations through
+// memberships, and requests made within an organization only see its members.
+type Organization struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name string `gorm:"not null" json:"name"`
+	Slug string `gorm:"unique;not null" json:"slug"`
+}
+
+// TenantScope limits queries within an organization to the organization itself
+func (Organization) TenantScope(organizationID uint) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}, Value: organizationID}
+}
+
+// Membership makes a user a member of an organization. Role is a role the user holds
+// only while working in that organization, on top of their own roles.
+type Membership struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	OrganizationID uint   `gorm:"not null;uniqueIndex:idx_memberships_organization_user" json:"organization_id"`
+	UserID         uint   `gorm:"not null;uniqueIndex:idx_memberships_organization_user;index" json:"user_id"`
+	Role           string `gorm:"not null;default:user" json:"role"`
+
+	Organization Organization `json:"-"`
+	User         User         `json:"-"`
+}
+
+// TenantScope limits queries within an organization to its memberships
+func (Membership) TenantScope(organizationID uint) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Value: organizationID}
+}
+
+// Tenant is the organization a request is made in, as resolved by middleware.
+// Role is the caller's membership role; it is empty for platform admins who are not members.
+type Tenant struct {
+	OrganizationID uint   `json:"id"`
+	Slug           string `json:"slug"`
+	Role           string `json:"role,omitempty"`
+}
+
+// OrganizationResponse represents an organization in API responses, with the caller's
+// membership role where it applies
+type OrganizationResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	Role      string    `json:"role,omitempty"`
+	Current   bool      `json:"current,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ToResponse converts Organization to OrganizationResponse
+func (o *Organization) ToResponse() OrganizationResponse {
+	return OrganizationResponse{
+		ID:        o.ID,
+		Name:      o.Name,
+		Slug:      o.Slug,
+		CreatedAt: o.CreatedAt,
+	}
+}
+
+// MemberResponse represents a member of an organization in API responses
+type MemberResponse struct {
+	User     UserResponse `json:"user"`
+	Role     string       `json:"role"`
+	JoinedAt time.Time    `json:"joined_at"`
+}
+
+// ToMemberResponse converts Membership to MemberResponse; the user must be preloaded
+func (m *Membership) ToMemberResponse() MemberResponse {
+	return MemberResponse{
+		User:     m.User.ToResponse(),
+		Role:     m.Role,
+		JoinedAt: m.CreatedAt,
+	}
+}
+
+// CreateOrganizationRequest represents a request to create an organization.
+// The slug identifies it in the X-Organization header and as a subdomain.
+type CreateOrganizationRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+	Slug string `json:"slug" validate:"required,min=2,max=63"`
+}
+
+// MembershipRequest adds a user to an organization or changes their membership role
+type MembershipRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// SwitchOrganizationRequest selects the organization of the current session;
+// an empty slug leaves every organization
+type SwitchOrganizationRequest struct {
+	Organization string `json:"organization" validate:"max=63"`
+}
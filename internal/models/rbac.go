@@ -0,0 +1,106 @@
+package models
+
+import (
+	"time"
+)
+
+// Built-in roles. They cannot be deleted, and the admin role always holds every permission.
+// The org_admin role is meant as a membership role for administrators of one organization.
+const (
+	RoleAdmin    = "admin"
+	RoleUser     = "user"
+	RoleOrgAdmin = "org_admin"
+)
+
+// Permissions checked by the API. They are enforced in code, so new ones are added with a migration;
+// which roles hold them is managed at runtime.
+const (
+	PermissionUsersRead        = "users:read"
+	PermissionUsersWrite       = "users:write"
+	PermissionUsersDelete      = "users:delete"
+	PermissionUsersInvite      = "users:invite"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionSessionsManage   = "sessions:manage"
+	PermissionRolesManage      = "roles:manage"
+	PermissionMFAManage        = "mfa:manage"
+	PermissionOAuthClients     = "oauth_clients:manage"
+	PermissionAuditRead        = "audit:read"
+	PermissionOrganizations    = "organizations:manage"
+)
+
+// Permission represents a named right that roles can be granted
+type Permission struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Name        string `gorm:"unique;not null" json:"name"`
+	Description string `gorm:"not null;default:''" json:"description"`
+}
+
+// Role represents a named set of permissions. A user's primary role is stored in
+// users.role; further roles are assigned through UserRole.
+type Role struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name        string       `gorm:"unique;not null" json:"name"`
+	Description string       `gorm:"not null;default:''" json:"description"`
+	BuiltIn     bool         `gorm:"column:built_in;not null;default:false" json:"built_in"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"-"`
+}
+
+// UserRole assigns an additional role to a user
+type UserRole struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	RoleID    uint      `gorm:"primaryKey" json:"role_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoleResponse represents a role in API responses
+type RoleResponse struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	BuiltIn     bool      `json:"built_in"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ToResponse converts Role to RoleResponse; the permissions must be preloaded
+func (r *Role) ToResponse() RoleResponse {
+	permissions := make([]string, len(r.Permissions))
+	for i, permission := range r.Permissions {
+		permissions[i] = permission.Name
+	}
+
+	return RoleResponse{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		BuiltIn:     r.BuiltIn,
+		Permissions: permissions,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
+
+// CreateRoleRequest represents a request to create a role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required,min=2,max=50"`
+	Description string   `json:"description" validate:"max=255"`
+	Permissions []string `json:"permissions" validate:"dive,required"`
+}
+
+// UpdateRoleRequest represents a request to change a role's description and permissions
+type UpdateRoleRequest struct {
+	Description string   `json:"description" validate:"max=255"`
+	Permissions []string `json:"permissions" validate:"required,dive,required"`
+}
+
+// UserRolesRequest sets every role of a user. The primary role is kept when it is
+// listed, otherwise the first role listed becomes the primary role.
+type UserRolesRequest struct {
+	Roles []string `json:"roles" validate:"required,min=1,dive,required"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken represents an opaque refresh token issued alongside an access token.
+// Only the SHA-256 hash of the token is stored. Every token obtained by rotating
+// the same login shares a FamilyID, so reuse of a rotated token can revoke them all.
+type RefreshToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	FamilyID  string     `gorm:"not null;index" json:"family_id"`
+	TokenHash string     `gorm:"unique;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// RefreshRequest represents a request to exchange a refresh token for a new token pair
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
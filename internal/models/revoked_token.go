@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken represents an access token that was revoked before its expiry, e.g. on logout.
+// UserID is nil for tokens issued to OAuth clients acting on their own behalf.
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;primaryKey" json:"jti"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    *uint     `gorm:"index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"golang-base/pkg/utils"
+
+	"gorm.io/gorm/clause"
+)
+
+// Session represents a login on one device. Its ID is the family ID shared by the
+// refresh tokens of the login and the "sid" claim of its access tokens.
+// IPAddress and UserAgent are those of the most recent login or refresh.
+type Session struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	IPAddress  string     `gorm:"not null;default:''" json:"ip_address"`
+	UserAgent  string     `gorm:"not null;default:''" json:"user_agent"`
+	LastSeenAt time.Time  `gorm:"not null" json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// OrganizationID is the organization the session works in, carried by its access tokens
+	OrganizationID *uint `json:"organization_id,omitempty"`
+}
+
+// TenantScope limits queries within an organization to the sessions of its members
+func (Session) TenantScope(organizationID uint) clause.Expression {
+	return memberOf(clause.Column{Table: clause.CurrentTable, Name: "user_id"}, organizationID)
+}
+
+// SessionResponse represents a session in API responses, with readable device and location labels
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	Location   string    `json:"location"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ToResponse converts a Session to a SessionResponse; currentID is the session of the caller
+func (s *Session) ToResponse(currentID string) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID,
+		Device:     utils.DescribeUserAgent(s.UserAgent),
+		Location:   utils.DescribeIPLocation(s.IPAddress),
+		IPAddress:  s.IPAddress,
+		UserAgent:  s.UserAgent,
+		Current:    s.ID == currentID,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+	}
+}
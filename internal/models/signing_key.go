@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey represents an asymmetric key pair used to sign access tokens.
+// The newest key without RetiredAt signs new tokens; retired keys keep
+// verifying tokens until ExpiresAt so that rotation doesn't invalidate them.
+type SigningKey struct {
+	KID       string    `gorm:"column:kid;primaryKey" json:"kid"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Algorithm  string     `gorm:"not null" json:"algorithm"`
+	PrivateKey string     `gorm:"not null" json:"-"`
+	PublicKey  string     `gorm:"not null" json:"-"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
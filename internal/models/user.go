@@ -1,9 +1,13 @@
 package models
 
 import (
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // User represents a user in the system
@@ -19,6 +23,32 @@ type User struct {
 	LastName  string `gorm:"not null" json:"last_name" validate:"required"`
 	Role      string `gorm:"default:user" json:"role"`
 	Active    bool   `gorm:"default:true" json:"active"`
+
+	Department string `gorm:"not null;default:''" json:"department"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TokenVersion    int        `gorm:"not null;default:0" json:"-"`
+
+	MFAEnabled   bool   `gorm:"column:mfa_enabled;not null;default:false" json:"mfa_enabled"`
+	TOTPSecret   string `gorm:"column:totp_secret;not null;default:''" json:"-"`
+	TOTPLastStep int64  `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LastFailedLoginAt   *time.Time `json:"-"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+}
+
+// TenantScope limits queries within an organization to its members
+func (User) TenantScope(organizationID uint) clause.Expression {
+	return memberOf(clause.Column{Table: clause.CurrentTable, Name: "id"}, organizationID)
+}
+
+// memberOf matches rows whose user ID column belongs to a member of the organization
+func memberOf(column clause.Column, organizationID uint) clause.Expression {
+	return clause.Expr{
+		SQL:  "? IN (SELECT user_id FROM memberships WHERE organization_id = ?)",
+		Vars: []any{column, organizationID},
+	}
 }
 
 // UserResponse represents the user data sent in API responses (without sensitive fields)
@@ -31,6 +61,12 @@ type UserResponse struct {
 	Active    bool      `json:"active"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	Department string `json:"department"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	MFAEnabled      bool       `json:"mfa_enabled"`
+	LockedUntil     *time.Time `json:"locked_until,omitempty"`
 }
 
 // ToResponse converts User to UserResponse
@@ -44,6 +80,11 @@ func (u *User) ToResponse() UserResponse {
 		Active:    u.Active,
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
+
+		Department:      u.Department,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		MFAEnabled:      u.MFAEnabled,
+		LockedUntil:     u.LockedUntil,
 	}
 }
 
@@ -61,9 +102,78 @@ type RegisterRequest struct {
 	LastName  string `json:"last_name" validate:"required"`
 }
 
-// JWTCustomClaims represents the claims in JWT tokens
+// CreateUserRequest represents an account created by an admin, directly or as a row of a
+// bulk import. Role defaults to user; Active defaults to true.
+type CreateUserRequest struct {
+	Email         string `json:"email" validate:"required,email"`
+	Password      string `json:"password" validate:"omitempty,min=8"`
+	FirstName     string `json:"first_name" validate:"required"`
+	LastName      string `json:"last_name" validate:"required"`
+	Role          string `json:"role"`
+	Department    string `json:"department" validate:"max=100"`
+	Active        *bool  `json:"active"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// ChangePasswordRequest represents a request by an authenticated user to change their password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,nefield=CurrentPassword"`
+}
+
+// JWTCustomClaims represents the claims in access tokens.
+// The registered claims carry the issuer, audience, subject (the user ID),
+// token ID and validity window; SessionID is the refresh token family.
+// Tokens issued to OAuth clients also carry ClientID and the granted Scope;
+// for the client credentials grant there is no user and the subject is the client ID.
+// Requests authenticated with an API key get claims built from the key, with APIKeyID
+// set and no token ID or validity window; they are never serialized into a token.
+// Impersonation tokens act as the impersonated user and name the admin behind them in Actor.
+// Roles and Permissions are resolved from the database on every request, so that role
+// changes apply immediately; they are never serialized into a token.
+// OrganizationID is the organization selected for the session, if any.
 type JWTCustomClaims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID         uint        `json:"user_id,omitempty"`
+	Email          string      `json:"email,omitempty"`
+	Role           string      `json:"role,omitempty"`
+	SessionID      string      `json:"sid,omitempty"`
+	TokenVersion   int         `json:"ver"`
+	OrganizationID uint        `json:"org,omitempty"`
+	ClientID       string      `json:"client_id,omitempty"`
+	Scope          string      `json:"scope,omitempty"`
+	APIKeyID       uint        `json:"-"`
+	Roles          []string    `json:"-"`
+	Permissions    []string    `json:"-"`
+	Actor          *ActorClaim `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ActorClaim identifies the admin who is acting as another user (RFC 8693 "act" claim).
+// TokenVersion is the admin's, so logging the admin out everywhere also ends the impersonation.
+type ActorClaim struct {
+	Subject      string `json:"sub"`
+	UserID       uint   `json:"user_id"`
+	Email        string `json:"email"`
+	TokenVersion int    `json:"ver"`
+}
+
+// HasRole reports whether the user holds role, as primary role or as one of the Roles
+// resolved for the request
+func (c *JWTCustomClaims) HasRole(role string) bool {
+	return c.Role == role || slices.Contains(c.Roles, role)
+}
+
+// HasPermission reports whether the user's roles grant permission
+func (c *JWTCustomClaims) HasPermission(permission string) bool {
+	return slices.Contains(c.Permissions, permission)
+}
+
+// Impersonating reports whether the token was issued to an admin acting as this user
+func (c *JWTCustomClaims) Impersonating() bool {
+	return c.Actor != nil
+}
+
+// HasScope reports whether the space-separated Scope contains scope
+func (c *JWTCustomClaims) HasScope(scope string) bool {
+	return slices.Contains(strings.Fields(c.Scope), scope)
 }
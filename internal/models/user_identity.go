@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect provider.
+// Provider is the issuer URL and Subject the provider's stable user identifier,
+// so the pair identifies the external account regardless of email changes.
+type UserIdentity struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Provider    string     `gorm:"not null" json:"provider"`
+	Subject     string     `gorm:"not null" json:"subject"`
+	Email       string     `gorm:"not null;default:''" json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebAuthn ceremonies a stored challenge can be used for
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential represents a passkey or security key registered by a user.
+// SignCount is the authenticator's signature counter, used to detect cloned authenticators;
+// Transports is a space-separated list of hints for how the browser reaches the authenticator.
+type WebAuthnCredential struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	UserID          uint       `gorm:"not null;index" json:"user_id"`
+	Name            string     `gorm:"not null" json:"name"`
+	CredentialID    []byte     `gorm:"unique;not null" json:"-"`
+	PublicKey       []byte     `gorm:"not null" json:"-"`
+	AttestationType string     `gorm:"not null;default:''" json:"-"`
+	AAGUID          []byte     `gorm:"column:aaguid" json:"-"`
+	SignCount       int64      `gorm:"not null;default:0" json:"-"`
+	Transports      string     `gorm:"not null;default:''" json:"-"`
+	BackupEligible  bool       `gorm:"not null;default:false" json:"backup_eligible"`
+	BackupState     bool       `gorm:"not null;default:false" json:"backup_state"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+}
+
+// TableName overrides the default table name
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnChallenge stores the session data of a registration or login ceremony in progress.
+// Challenges are single-use: they are deleted when the ceremony is finished.
+// UserID is nil for passwordless logins, where the user is only known from the assertion.
+type WebAuthnChallenge struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID      *uint     `gorm:"index" json:"user_id"`
+	Ceremony    string    `gorm:"not null" json:"ceremony"`
+	SessionData string    `gorm:"not null" json:"-"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName overrides the default table name
+func (WebAuthnChallenge) TableName() string {
+	return "webauthn_challenges"
+}
+
+// WebAuthnRegisterRequest finishes registering a passkey for the current user
+type WebAuthnRegisterRequest struct {
+	ChallengeID string          `json:"challenge_id" validate:"required"`
+	Name        string          `json:"name" validate:"max=100"`
+	Credential  json.RawMessage `json:"credential" validate:"required"`
+}
+
+// WebAuthnLoginRequest finishes a passwordless login with a passkey
+type WebAuthnLoginRequest struct {
+	ChallengeID string          `json:"challenge_id" validate:"required"`
+	Credential  json.RawMessage `json:"credential" validate:"required"`
+}
+
+// MFAWebAuthnBeginRequest starts answering an MFA challenge with a passkey
+type MFAWebAuthnBeginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+// MFAWebAuthnVerifyRequest answers an MFA challenge with a passkey assertion
+type MFAWebAuthnVerifyRequest struct {
+	MFAToken    string          `json:"mfa_token" validate:"required"`
+	ChallengeID string          `json:"challenge_id" validate:"required"`
+	Credential  json.RawMessage `json:"credential" validate:"required"`
+}
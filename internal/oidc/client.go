@@ -0,0 +1,336 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// discoveryTTL is how long provider metadata is cached before it is fetched again
+	discoveryTTL = time.Hour
+
+	// jwksRefreshInterval limits how often the provider's keys are refetched for an unknown kid
+	jwksRefreshInterval = 30 * time.Second
+
+	// maxResponseSize bounds the provider responses read into memory
+	maxResponseSize = 1 << 20
+)
+
+// Discovery is the subset of the provider metadata document (OpenID Connect Discovery 1.0)
+// used by the relying party
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// IDTokenClaims represents the claims of an ID token used to identify the user
+type IDTokenClaims struct {
+	Email           string   `json:"email"`
+	EmailVerified   flexBool `json:"email_verified"`
+	Name            string   `json:"name"`
+	GivenName       string   `json:"given_name"`
+	FamilyName      string   `json:"family_name"`
+	Nonce           string   `json:"nonce"`
+	AuthorizedParty string   `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// tokenResponse is the token endpoint's response to an authorization code grant
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Client is an OpenID Connect relying party for a single provider.
+// It signs users in with the authorization code flow and PKCE, discovers the
+// provider's endpoints and validates ID tokens against its published keys.
+type Client struct {
+	config     *config.Config
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *Discovery
+	discoveredAt  time.Time
+	keys          map[string]auth.JWK
+	keysFetchedAt time.Time
+}
+
+// NewClient creates a relying party for the configured provider
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		keys:       make(map[string]auth.JWK),
+	}
+}
+
+// Enabled reports whether a provider is configured
+func (c *Client) Enabled() bool {
+	return c.config.OIDCEnabled()
+}
+
+// AuthCodeURL returns the provider URL that starts an authorization code flow
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.config.OIDCClientID},
+		"redirect_uri":          {c.config.OIDCCallbackURL()},
+		"scope":                 {c.config.OIDCScopes},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the validated ID token claims
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDTokenClaims, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.OIDCCallbackURL()},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.config.OIDCClientID), url.QueryEscape(c.config.OIDCClientSecret))
+
+	var token tokenResponse
+	status, err := c.doJSON(req, &token)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return c.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken validates an ID token's signature, issuer, audience, validity window and nonce
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	discovery, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	token, err := jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := c.signingKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+			return nil, errors.New("signing algorithm does not match key")
+		}
+		return key.PublicKey()
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(c.config.OIDCClientID),
+		jwt.WithLeeway(c.config.JWTLeeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	// With several audiences the token must have been issued to us
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.config.OIDCClientID {
+		return nil, errors.New("ID token authorized party mismatch")
+	}
+
+	return claims, nil
+}
+
+// Discover returns the provider metadata, fetching it when the cache is stale
+func (c *Client) Discover(ctx context.Context) (*Discovery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.discovery != nil && time.Since(c.discoveredAt) < discoveryTTL {
+		return c.discovery, nil
+	}
+
+	issuer := strings.TrimRight(c.config.OIDCIssuerURL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery Discovery
+	status, err := c.doJSON(req, &discovery)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery request failed with status %d", status)
+	}
+
+	// The issuer in the metadata must match the configured one (Discovery 1.0, section 4.3)
+	if strings.TrimRight(discovery.Issuer, "/") != issuer {
+		return nil, errors.New("discovered issuer does not match the configured issuer")
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("provider metadata is incomplete")
+	}
+	if len(discovery.CodeChallengeMethods) > 0 && !slices.Contains(discovery.CodeChallengeMethods, "S256") {
+		return nil, errors.New("provider does not support PKCE with S256")
+	}
+
+	c.discovery = &discovery
+	c.discoveredAt = time.Now()
+	return c.discovery, nil
+}
+
+// signingKey returns the provider key with the given kid, refetching the key set
+// when the kid is unknown so that provider key rotations are picked up
+func (c *Client) signingKey(ctx context.Context, kid string) (auth.JWK, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(c.keysFetchedAt) < jwksRefreshInterval {
+		return auth.JWK{}, errors.New("unknown signing key")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.discovery.JWKSURI, nil)
+	if err != nil {
+		return auth.JWK{}, err
+	}
+
+	var set auth.JWKSet
+	status, err := c.doJSON(req, &set)
+	if err != nil {
+		return auth.JWK{}, err
+	}
+	if status != http.StatusOK {
+		return auth.JWK{}, fmt.Errorf("JWKS request failed with status %d", status)
+	}
+
+	c.keys = make(map[string]auth.JWK, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use == "" || key.Use == "sig" {
+			c.keys[key.KeyID] = key
+		}
+	}
+	c.keysFetchedAt = time.Now()
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key, nil
+	}
+	return auth.JWK{}, errors.New("unknown signing key")
+}
+
+// lookupKey finds a cached key by kid; tokens without a kid are accepted only
+// when the provider publishes a single key
+func (c *Client) lookupKey(kid string) (auth.JWK, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// doJSON performs a request and decodes its JSON body, returning the status code
+func (c *Client) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+
+	return resp.StatusCode, nil
+}
+
+// CodeChallenge derives the S256 PKCE code challenge for a code verifier (RFC 7636)
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// flexBool accepts both JSON booleans and the "true"/"false" strings some providers send
+type flexBool bool
+
+// UnmarshalJSON implements json.Unmarshaler
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
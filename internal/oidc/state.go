@@ -0,0 +1,68 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/pkg/utils"
+)
+
+// LoginState is what the relying party must remember between redirecting the
+// browser to the provider and handling the callback. It is kept in an encrypted
+// cookie, so no server-side storage is needed.
+type LoginState struct {
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ReturnTo     string    `json:"return_to,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// NewLoginState generates the state, nonce and PKCE code verifier for a new login
+func NewLoginState(ttl time.Duration) (*LoginState, error) {
+	values := make([]string, 3)
+	for i := range values {
+		value, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	return &LoginState{
+		State:        values[0],
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		ExpiresAt:    time.Now().Add(ttl),
+	}, nil
+}
+
+// Seal encrypts the login state for storage in a cookie
+func (s *LoginState) Seal(cipher *auth.Cipher) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return cipher.Encrypt(string(data))
+}
+
+// OpenLoginState decrypts a login state cookie and checks that it has not expired
+func OpenLoginState(cipher *auth.Cipher, sealed string) (*LoginState, error) {
+	data, err := cipher.Decrypt(sealed)
+	if err != nil {
+		return nil, errors.New("invalid login state")
+	}
+
+	var state LoginState
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		return nil, errors.New("invalid login state")
+	}
+
+	if time.Now().After(state.ExpiresAt) {
+		return nil, errors.New("login state expired")
+	}
+
+	return &state, nil
+}
@@ -0,0 +1,357 @@
+package passkey
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"golang-base/internal/config"
+	"golang-base/internal/models"
+	"golang-base/pkg/utils"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidChallenge is returned when a ceremony is finished with an unknown, expired or reused challenge
+	ErrInvalidChallenge = errors.New("invalid or expired passkey challenge")
+	// ErrNoCredentials is returned when a user without passkeys starts a login ceremony
+	ErrNoCredentials = errors.New("no passkeys registered")
+	// ErrVerificationFailed is returned when an attestation or assertion does not verify
+	ErrVerificationFailed = errors.New("passkey verification failed")
+	// ErrClonedAuthenticator is returned when an authenticator's signature counter did not increase
+	ErrClonedAuthenticator = errors.New("passkey signature counter did not increase")
+)
+
+// Service runs WebAuthn registration and login ceremonies. Ceremony state is kept
+// in the webauthn_challenges table so that any instance can finish a ceremony.
+type Service struct {
+	db       *gorm.DB
+	webAuthn *webauthn.WebAuthn
+	ttl      time.Duration
+}
+
+// NewService configures the relying party from the application config.
+// Attestation is not requested: passkeys are trusted on first use, as most consumer
+// authenticators do not provide verifiable attestation anyway.
+func NewService(db *gorm.DB, cfg *config.Config) (*Service, error) {
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.WebAuthnChallengeTTL, TimeoutUVD: cfg.WebAuthnChallengeTTL}
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:                  cfg.WebAuthnRelyingPartyID(),
+		RPDisplayName:         cfg.WebAuthnRPName,
+		RPOrigins:             cfg.WebAuthnAllowedOrigins(),
+		AttestationPreference: protocol.PreferNoAttestation,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		},
+		Timeouts: webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{db: db, webAuthn: webAuthn, ttl: cfg.WebAuthnChallengeTTL}, nil
+}
+
+// UserHandle returns the opaque user handle stored on the authenticator for a user.
+// It is the user ID as 8 big-endian bytes, so it reveals nothing like the email address.
+func UserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// BeginRegistration starts registering a new passkey for the user.
+// Credentials the user already has are excluded so the same authenticator is not registered twice.
+func (s *Service) BeginRegistration(user *models.User) (*protocol.CredentialCreation, string, error) {
+	account, err := s.loadAccount(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclusions := webauthn.Credentials(account.WebAuthnCredentials()).CredentialDescriptors()
+	creation, session, err := s.webAuthn.BeginRegistration(account, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, "", err
+	}
+
+	challengeID, err := s.saveChallenge(models.WebAuthnCeremonyRegistration, &user.ID, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, challengeID, nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new credential
+func (s *Service) FinishRegistration(user *models.User, challengeID, name string, response []byte) (*models.WebAuthnCredential, error) {
+	session, err := s.takeChallenge(challengeID, models.WebAuthnCeremonyRegistration, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, ErrVerificationFailed
+	}
+
+	account, err := s.loadAccount(user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.CreateCredential(account, *session, parsed)
+	if err != nil {
+		return nil, ErrVerificationFailed
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	record := models.WebAuthnCredential{
+		UserID:          user.ID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		Transports:      strings.Join(transports, " "),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// BeginLogin starts a login ceremony. With a user it asks for one of that user's
+// passkeys, as a second factor; without one it asks for any discoverable passkey,
+// for passwordless login, and requires user verification so the passkey is a full
+// multi-factor credential on its own.
+func (s *Service) BeginLogin(user *models.User) (*protocol.CredentialAssertion, string, error) {
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		userID    *uint
+		err       error
+	)
+
+	if user == nil {
+		assertion, session, err = s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		account, loadErr := s.loadAccount(user)
+		if loadErr != nil {
+			return nil, "", loadErr
+		}
+		if len(account.credentials) == 0 {
+			return nil, "", ErrNoCredentials
+		}
+		assertion, session, err = s.webAuthn.BeginLogin(account)
+		userID = &user.ID
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	challengeID, err := s.saveChallenge(models.WebAuthnCeremonyLogin, userID, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, challengeID, nil
+}
+
+// FinishLogin verifies an assertion started by BeginLogin and returns the user it belongs to.
+// The user must be the one passed to BeginLogin, or nil for a passwordless login.
+func (s *Service) FinishLogin(user *models.User, challengeID string, response []byte) (*models.User, error) {
+	var userID *uint
+	if user != nil {
+		userID = &user.ID
+	}
+
+	session, err := s.takeChallenge(challengeID, models.WebAuthnCeremonyLogin, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, ErrVerificationFailed
+	}
+
+	var (
+		account    *passkeyUser
+		credential *webauthn.Credential
+	)
+	if user == nil {
+		var found webauthn.User
+		found, credential, err = s.webAuthn.ValidatePasskeyLogin(s.findAccount, *session, parsed)
+		if err == nil {
+			account = found.(*passkeyUser)
+		}
+	} else {
+		account, err = s.loadAccount(user)
+		if err != nil {
+			return nil, err
+		}
+		credential, err = s.webAuthn.ValidateLogin(account, *session, parsed)
+	}
+	if err != nil {
+		return nil, ErrVerificationFailed
+	}
+
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrClonedAuthenticator
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&models.WebAuthnCredential{}).
+		Where("user_id = ? AND credential_id = ?", account.user.ID, credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":   int64(credential.Authenticator.SignCount),
+			"backup_state": credential.Flags.BackupState,
+			"last_used_at": now,
+		}).Error; err != nil {
+		return nil, err
+	}
+
+	return account.user, nil
+}
+
+// findAccount resolves the user handle of a discoverable credential to an active user
+func (s *Service) findAccount(rawID, userHandle []byte) (webauthn.User, error) {
+	if len(userHandle) != 8 {
+		return nil, ErrVerificationFailed
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ? AND active = ?", uint(binary.BigEndian.Uint64(userHandle)), true).First(&user).Error; err != nil {
+		return nil, ErrVerificationFailed
+	}
+	return s.loadAccount(&user)
+}
+
+// saveChallenge stores the session data of a ceremony and returns the ID the client must send back
+func (s *Service) saveChallenge(ceremony string, userID *uint, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	id, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	// Ceremonies that were never finished are cleaned up as new ones start
+	now := time.Now()
+	s.db.Where("expires_at < ?", now).Delete(&models.WebAuthnChallenge{})
+
+	challenge := models.WebAuthnChallenge{
+		ID:          id,
+		UserID:      userID,
+		Ceremony:    ceremony,
+		SessionData: string(data),
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	if err := s.db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// takeChallenge deletes a challenge and returns its session data, so each challenge
+// can be answered at most once even by concurrent requests
+func (s *Service) takeChallenge(id, ceremony string, userID *uint) (*webauthn.SessionData, error) {
+	var challenge models.WebAuthnChallenge
+	result := s.db.Clauses(clause.Returning{}).
+		Where("id = ? AND ceremony = ?", id, ceremony).
+		Delete(&challenge)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(challenge.ExpiresAt) {
+		return nil, ErrInvalidChallenge
+	}
+
+	switch {
+	case userID == nil && challenge.UserID != nil,
+		userID != nil && (challenge.UserID == nil || *challenge.UserID != *userID):
+		return nil, ErrInvalidChallenge
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(challenge.SessionData), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// loadAccount loads the user's credentials for a ceremony
+func (s *Service) loadAccount(user *models.User) (*passkeyUser, error) {
+	var credentials []models.WebAuthnCredential
+	if err := s.db.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return &passkeyUser{user: user, credentials: credentials}, nil
+}
+
+// passkeyUser adapts a user and their stored credentials to the webauthn.User interface
+type passkeyUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (a *passkeyUser) WebAuthnID() []byte {
+	return UserHandle(a.user.ID)
+}
+
+func (a *passkeyUser) WebAuthnName() string {
+	return a.user.Email
+}
+
+func (a *passkeyUser) WebAuthnDisplayName() string {
+	if name := strings.TrimSpace(a.user.FirstName + " " + a.user.LastName); name != "" {
+		return name
+	}
+	return a.user.Email
+}
+
+func (a *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(a.credentials))
+	for i, stored := range a.credentials {
+		var transports []protocol.AuthenticatorTransport
+		for _, transport := range strings.Fields(stored.Transports) {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              stored.CredentialID,
+			PublicKey:       stored.PublicKey,
+			AttestationType: stored.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: stored.BackupEligible,
+				BackupState:    stored.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    stored.AAGUID,
+				SignCount: uint32(stored.SignCount),
+			},
+		}
+	}
+	return credentials
+}
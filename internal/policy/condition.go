@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Condition is a boolean expression over the attributes of a request. It is either
+// a group (All, Any or Not) or a comparison of the attribute Attr, such as
+// "subject.department", with a literal Value or with another attribute Ref.
+type Condition struct {
+	All []Condition `json:"all,omitempty"`
+	Any []Condition `json:"any,omitempty"`
+	Not *Condition  `json:"not,omitempty"`
+
+	Attr  string `json:"attr,omitempty"`
+	Op    string `json:"op,omitempty"`
+	Value any    `json:"value,omitempty"`
+	Ref   string `json:"ref,omitempty"`
+}
+
+// Comparison operators. "in" tests whether the attribute is one of a list of values,
+// "contains" whether a list attribute (such as subject.roles) contains the value.
+var operators = []string{"eq", "ne", "in", "not_in", "contains", "gt", "gte", "lt", "lte", "exists"}
+
+// validate checks that the condition is exactly one group or one well-formed comparison
+func (c *Condition) validate() error {
+	kinds := 0
+	for _, set := range []bool{c.All != nil, c.Any != nil, c.Not != nil, c.Attr != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return errors.New("a condition needs exactly one of all, any, not or attr")
+	}
+
+	for _, group := range [][]Condition{c.All, c.Any} {
+		for i := range group {
+			if err := group[i].validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if c.Not != nil {
+		return c.Not.validate()
+	}
+	if c.Attr == "" {
+		return nil
+	}
+
+	if !validAttribute(c.Attr) {
+		return fmt.Errorf("attribute %q must start with subject., resource. or request.", c.Attr)
+	}
+	if !slices.Contains(operators, c.Op) {
+		return fmt.Errorf("unknown operator %q for %s", c.Op, c.Attr)
+	}
+	if c.Ref != "" && !validAttribute(c.Ref) {
+		return fmt.Errorf("attribute %q must start with subject., resource. or request.", c.Ref)
+	}
+	if c.Op == "exists" && (c.Value != nil || c.Ref != "") {
+		return fmt.Errorf("exists takes no value for %s", c.Attr)
+	}
+	if c.Op != "exists" && (c.Value == nil) == (c.Ref == "") {
+		return fmt.Errorf("%s needs either a value or a ref", c.Attr)
+	}
+	if (c.Op == "in" || c.Op == "not_in") && c.Ref == "" {
+		if _, ok := c.Value.([]any); !ok {
+			return fmt.Errorf("%s %s needs a list value", c.Attr, c.Op)
+		}
+	}
+	return nil
+}
+
+// validAttribute reports whether an attribute path names one of the attribute sets
+func validAttribute(attr string) bool {
+	for _, prefix := range []string{"subject.", "resource.", "request."} {
+		if strings.HasPrefix(attr, prefix) && len(attr) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate reports whether the condition holds for the input
+func (c *Condition) Evaluate(in *Input) bool {
+	switch {
+	case c.All != nil:
+		for i := range c.All {
+			if !c.All[i].Evaluate(in) {
+				return false
+			}
+		}
+		return true
+	case c.Any != nil:
+		for i := range c.Any {
+			if c.Any[i].Evaluate(in) {
+				return true
+			}
+		}
+		return false
+	case c.Not != nil:
+		return !c.Not.Evaluate(in)
+	}
+
+	actual, found := in.lookup(c.Attr)
+	if c.Op == "exists" {
+		return found && !isEmpty(actual)
+	}
+	if !found {
+		return false
+	}
+
+	expected := c.Value
+	if c.Ref != "" {
+		var ok bool
+		if expected, ok = in.lookup(c.Ref); !ok {
+			return false
+		}
+	}
+
+	switch c.Op {
+	case "eq":
+		return equal(actual, expected)
+	case "ne":
+		return !equal(actual, expected)
+	case "in":
+		return listContains(expected, actual)
+	case "not_in":
+		return !listContains(expected, actual)
+	case "contains":
+		return listContains(actual, expected)
+	default:
+		a, aok := number(actual)
+		b, bok := number(expected)
+		if !aok || !bok {
+			return false
+		}
+		switch c.Op {
+		case "gt":
+			return a > b
+		case "gte":
+			return a >= b
+		case "lt":
+			return a < b
+		case "lte":
+			return a <= b
+		}
+	}
+	return false
+}
+
+// equal compares two attribute values; numbers compare by value whatever their Go type,
+// and empty strings never equal each other, so two unset attributes do not match
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	if s, ok := a.(string); ok && s == "" {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// listContains reports whether list is a list with an element equal to value
+func listContains(list, value any) bool {
+	items := reflect.ValueOf(list)
+	if items.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < items.Len(); i++ {
+		if equal(items.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// number converts numeric attribute values to float64, as JSON numbers in the policy file are
+func number(value any) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// isEmpty reports whether an attribute value is the zero value of its type
+func isEmpty(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConditionEvaluate(t *testing.T) {
+	in := &Input{
+		Action: "users:write",
+		Subject: Attributes{
+			"id":         uint(1),
+			"roles":      []string{"user", "team_lead"},
+			"department": "sales",
+			"email":      "",
+		},
+		Resource: Resource{
+			Type: "user",
+			ID:   "2",
+			Attributes: Attributes{
+				"roles":      []string{"user", "admin"},
+				"department": "sales",
+				"manager":    "",
+			},
+		},
+		Request: Attributes{
+			"hour":    14,
+			"weekday": "saturday",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+	}{
+		{"eq value", `{"attr": "subject.department", "op": "eq", "value": "sales"}`, true},
+		{"eq ref", `{"attr": "resource.department", "op": "eq", "ref": "subject.department"}`, true},
+		{"empty strings are not equal", `{"attr": "subject.email", "op": "eq", "ref": "resource.manager"}`, false},
+		{"ne", `{"attr": "subject.department", "op": "ne", "value": "support"}`, true},
+		{"numbers compare across types", `{"attr": "subject.id", "op": "eq", "value": 1}`, true},
+		{"in", `{"attr": "request.weekday", "op": "in", "value": ["saturday", "sunday"]}`, true},
+		{"not_in", `{"attr": "request.weekday", "op": "not_in", "value": ["saturday", "sunday"]}`, false},
+		{"contains", `{"attr": "subject.roles", "op": "contains", "value": "team_lead"}`, true},
+		{"contains on a scalar", `{"attr": "subject.department", "op": "contains", "value": "sales"}`, false},
+		{"gt", `{"attr": "request.hour", "op": "gt", "value": 9}`, true},
+		{"gte", `{"attr": "request.hour", "op": "gte", "value": 14}`, true},
+		{"lt", `{"attr": "request.hour", "op": "lt", "value": 14}`, false},
+		{"lte", `{"attr": "request.hour", "op": "lte", "value": 14}`, true},
+		{"ordering a string", `{"attr": "subject.department", "op": "gt", "value": 1}`, false},
+		{"exists", `{"attr": "subject.department", "op": "exists"}`, true},
+		{"exists on an empty value", `{"attr": "resource.manager", "op": "exists"}`, false},
+		{"missing attribute", `{"attr": "subject.team", "op": "ne", "value": "sales"}`, false},
+		{"missing ref", `{"attr": "subject.department", "op": "eq", "ref": "resource.team"}`, false},
+		{"resource type", `{"attr": "resource.type", "op": "eq", "value": "user"}`, true},
+		{"all", `{"all": [
+			{"attr": "subject.roles", "op": "contains", "value": "team_lead"},
+			{"attr": "resource.department", "op": "eq", "ref": "subject.department"}
+		]}`, true},
+		{"all with a false member", `{"all": [
+			{"attr": "subject.roles", "op": "contains", "value": "team_lead"},
+			{"attr": "request.hour", "op": "lt", "value": 9}
+		]}`, false},
+		{"any", `{"any": [
+			{"attr": "request.hour", "op": "lt", "value": 9},
+			{"attr": "request.weekday", "op": "eq", "value": "saturday"}
+		]}`, true},
+		{"any without a true member", `{"any": [
+			{"attr": "request.hour", "op": "lt", "value": 9},
+			{"attr": "request.hour", "op": "gte", "value": 17}
+		]}`, false},
+		{"not contains", `{"not": {"attr": "resource.roles", "op": "contains", "value": "admin"}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var condition Condition
+			if err := json.Unmarshal([]byte(tt.condition), &condition); err != nil {
+				t.Fatalf("parse condition: %v", err)
+			}
+			if err := condition.validate(); err != nil {
+				t.Fatalf("validate condition: %v", err)
+			}
+
+			if got := condition.Evaluate(in); got != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package policy
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang-base/internal/auth"
+	"golang-base/internal/config"
+	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Decision reasons
+const (
+	ReasonPolicy       = "policy"
+	ReasonPermission   = "permission"
+	ReasonNoPermission = "no_permission"
+	ReasonAPIKeyScope  = "api_key_scope"
+	ReasonUnauthorized = "unauthenticated"
+)
+
+// Attributes are the named values a condition can refer to, such as "department"
+type Attributes map[string]any
+
+// Resource is the object an action is performed on. Type is matched against the
+// resources of policies; Attributes are available to conditions as resource.<name>.
+type Resource struct {
+	Type       string
+	ID         string
+	Attributes Attributes
+}
+
+// UserResource describes a user account as a resource. Besides the primary role it
+// lists every role of the user in roles, as subject.roles does for the current user.
+func UserResource(db *gorm.DB, user *models.User) (Resource, error) {
+	roles, err := auth.UserRoles(db, user)
+	if err != nil {
+		return Resource{}, err
+	}
+
+	return Resource{
+		Type: "user",
+		ID:   strconv.FormatUint(uint64(user.ID), 10),
+		Attributes: Attributes{
+			"id":         user.ID,
+			"email":      user.Email,
+			"role":       user.Role,
+			"roles":      roles,
+			"department": user.Department,
+			"active":     user.Active,
+		},
+	}, nil
+}
+
+// Input is what policies are evaluated against
+type Input struct {
+	Action   string
+	Subject  Attributes
+	Resource Resource
+	Request  Attributes
+}
+
+// lookup resolves an attribute path such as "subject.department"
+func (in *Input) lookup(attr string) (any, bool) {
+	set, name, _ := strings.Cut(attr, ".")
+
+	var attributes Attributes
+	switch set {
+	case "subject":
+		attributes = in.Subject
+	case "resource":
+		if name == "type" {
+			return in.Resource.Type, true
+		}
+		attributes = in.Resource.Attributes
+	case "request":
+		attributes = in.Request
+	}
+
+	value, ok := attributes[name]
+	return value, ok
+}
+
+// Decision is the outcome of an authorization check, as written to the decision log.
+// DryRunAllowed is set when dry-run policies matched and tells what the decision
+// would have been had they been enforced.
+type Decision struct {
+	Time          time.Time `json:"time"`
+	Allowed       bool      `json:"allowed"`
+	Reason        string    `json:"reason"`
+	PolicyID      string    `json:"policy_id,omitempty"`
+	Action        string    `json:"action"`
+	Resource      string    `json:"resource"`
+	SubjectID     uint      `json:"subject_id,omitempty"`
+	ActorID       uint      `json:"actor_id,omitempty"`
+	DryRunAllowed *bool     `json:"dry_run_allowed,omitempty"`
+	DryRunPolicy  string    `json:"dry_run_policy_id,omitempty"`
+}
+
+// DecisionLogger records authorization decisions
+type DecisionLogger interface {
+	LogDecision(decision *Decision)
+}
+
+// StdDecisionLogger writes decisions to the standard logger as JSON
+type StdDecisionLogger struct{}
+
+// LogDecision implements DecisionLogger
+func (StdDecisionLogger) LogDecision(decision *Decision) {
+	data, err := json.Marshal(decision)
+	if err != nil {
+		return
+	}
+	log.Printf("policy decision: %s", data)
+}
+
+// Engine authorizes actions with attribute-based policies on top of role permissions.
+// Deny policies override allow policies; when no enforced policy applies, the action
+// is allowed if the user's roles grant the permission of the same name.
+type Engine struct {
+	db       *gorm.DB
+	policies []Policy
+	location *time.Location
+	logger   DecisionLogger
+}
+
+// NewEngine creates an engine for the policies in file, which may be nil for role permissions
+// only. Decisions are written to logger unless it is nil.
+func NewEngine(db *gorm.DB, file *File, logger DecisionLogger) (*Engine, error) {
+	engine := &Engine{db: db, location: time.UTC, logger: logger}
+	if file == nil {
+		return engine, nil
+	}
+
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	if file.Timezone != "" {
+		location, err := time.LoadLocation(file.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		engine.location = location
+	}
+	engine.policies = file.Policies
+
+	return engine, nil
+}
+
+// Load creates the engine configured by POLICY_FILE and POLICY_DECISION_LOG.
+// Without a policy file, decisions follow role permissions alone.
+func Load(db *gorm.DB, cfg *config.Config) (*Engine, error) {
+	var logger DecisionLogger
+	if cfg.PolicyDecisionLog {
+		logger = StdDecisionLogger{}
+	}
+
+	if cfg.PolicyFile == "" {
+		return NewEngine(db, nil, logger)
+	}
+	file, err := LoadFile(cfg.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewEngine(db, file, logger)
+}
+
+// Authorize decides whether the authenticated user may perform action on resource.
+// Handlers call it for checks that depend on the resource or the request, and answer
+// with 403 when the decision is not Allowed. API keys need the admin scope.
+func (e *Engine) Authorize(c *fiber.Ctx, action string, resource Resource) *Decision {
+	decision := &Decision{
+		Time:     time.Now(),
+		Action:   action,
+		Resource: resource.Type + ":" + resource.ID,
+	}
+
+	claims := middleware.CurrentUser(c)
+	if claims == nil {
+		decision.Reason = ReasonUnauthorized
+		e.logDecision(decision)
+		return decision
+	}
+	decision.SubjectID = claims.UserID
+	if actor := middleware.Actor(c); actor != nil && actor.UserID != claims.UserID {
+		decision.ActorID = actor.UserID
+	}
+
+	if claims.APIKeyID != 0 && !claims.HasScope(models.APIKeyScopeAdmin) {
+		decision.Reason = ReasonAPIKeyScope
+		e.logDecision(decision)
+		return decision
+	}
+
+	in := &Input{
+		Action:   action,
+		Subject:  e.subjectAttributes(c, claims),
+		Resource: resource,
+		Request:  e.requestAttributes(c, decision.Time),
+	}
+
+	fallback := claims.HasPermission(action)
+	decision.Allowed, decision.PolicyID = e.decide(in, false, fallback)
+	switch {
+	case decision.PolicyID != "":
+		decision.Reason = ReasonPolicy
+	case decision.Allowed:
+		decision.Reason = ReasonPermission
+	default:
+		decision.Reason = ReasonNoPermission
+	}
+
+	if e.hasDryRun(in) {
+		allowed, policyID := e.decide(in, true, fallback)
+		decision.DryRunAllowed = &allowed
+		decision.DryRunPolicy = policyID
+	}
+
+	e.logDecision(decision)
+	return decision
+}
+
+// Require creates middleware that authorizes every listed permission through the engine,
+// like middleware.RequirePermission but subject to policies, so deny rules apply to routes
+// that have no resource to check in the handler. The resource is the route, of type "route"
+// with the route's path as ID.
+func (e *Engine) Require(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		resource := Resource{
+			Type:       "route",
+			ID:         c.Route().Path,
+			Attributes: Attributes{"path": c.Route().Path},
+		}
+
+		for _, permission := range permissions {
+			decision := e.Authorize(c, permission, resource)
+			switch {
+			case decision.Allowed:
+				continue
+			case decision.Reason == ReasonUnauthorized:
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Authentication required",
+				})
+			case decision.Reason == ReasonAPIKeyScope:
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "API key lacks the admin scope",
+				})
+			default:
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Insufficient permissions",
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// Evaluate decides an input directly, without a request. It is meant for tests and tools
+// that check a policy file; fallback is the decision when no policy applies.
+func (e *Engine) Evaluate(in *Input, fallback bool) (bool, string) {
+	return e.decide(in, false, fallback)
+}
+
+// decide applies the policies to the input: the first matching deny wins, otherwise
+// the first matching allow, otherwise fallback. Dry-run policies count only with dryRun set.
+// It returns the decision and the ID of the policy that made it.
+func (e *Engine) decide(in *Input, dryRun, fallback bool) (bool, string) {
+	allowedBy := ""
+	for i := range e.policies {
+		policy := &e.policies[i]
+		if policy.DryRun && !dryRun {
+			continue
+		}
+		if !policy.applies(in.Action, in.Resource.Type) {
+			continue
+		}
+		if policy.Condition != nil && !policy.Condition.Evaluate(in) {
+			continue
+		}
+
+		if policy.Effect == EffectDeny {
+			return false, policy.ID
+		}
+		if allowedBy == "" {
+			allowedBy = policy.ID
+		}
+	}
+
+	if allowedBy != "" {
+		return true, allowedBy
+	}
+	return fallback, ""
+}
+
+// hasDryRun reports whether any dry-run policy applies to the input
+func (e *Engine) hasDryRun(in *Input) bool {
+	for i := range e.policies {
+		policy := &e.policies[i]
+		if policy.DryRun && policy.applies(in.Action, in.Resource.Type) &&
+			(policy.Condition == nil || policy.Condition.Evaluate(in)) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectAttributes describes the authenticated user and the organization they work in.
+// The department is read from the database, since it is not part of the token.
+func (e *Engine) subjectAttributes(c *fiber.Ctx, claims *models.JWTCustomClaims) Attributes {
+	attributes := Attributes{
+		"id":                claims.UserID,
+		"email":             claims.Email,
+		"role":              claims.Role,
+		"roles":             claims.Roles,
+		"permissions":       claims.Permissions,
+		"impersonating":     claims.Impersonating(),
+		"api_key":           claims.APIKeyID != 0,
+		"department":        "",
+		"organization":      "",
+		"organization_role": "",
+	}
+	if current := middleware.CurrentTenant(c); current != nil {
+		attributes["organization"] = current.Slug
+		attributes["organization_role"] = current.Role
+	}
+
+	var departments []string
+	if err := e.db.Model(&models.User{}).Where("id = ?", claims.UserID).Pluck("department", &departments).Error; err == nil && len(departments) > 0 {
+		attributes["department"] = departments[0]
+	}
+	return attributes
+}
+
+// requestAttributes describes the request, with the time in the policy file's time zone
+func (e *Engine) requestAttributes(c *fiber.Ctx, now time.Time) Attributes {
+	local := now.In(e.location)
+	return Attributes{
+		"ip":      c.IP(),
+		"method":  c.Method(),
+		"path":    c.Path(),
+		"hour":    local.Hour(),
+		"minute":  local.Minute(),
+		"weekday": strings.ToLower(local.Weekday().String()),
+		"date":    local.Format(time.DateOnly),
+	}
+}
+
+// logDecision writes a decision to the decision log, if there is one
+func (e *Engine) logDecision(decision *Decision) {
+	if e.logger != nil {
+		e.logger.LogDecision(decision)
+	}
+}
@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang-base/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestEngineDecide(t *testing.T) {
+	sales := &Condition{Attr: "subject.department", Op: "eq", Value: "sales"}
+	file := &File{Policies: []Policy{
+		{ID: "allow-sales", Effect: EffectAllow, Actions: []string{"users:*"}, Resources: []string{"user"}, Condition: sales},
+		{ID: "deny-admins", Effect: EffectDeny, Actions: []string{"users:write"}, Resources: []string{"user"},
+			Condition: &Condition{Attr: "resource.roles", Op: "contains", Value: "admin"}},
+		{ID: "allow-all-writes", Effect: EffectAllow, Actions: []string{"users:write"}, Resources: []string{"*"}},
+		{ID: "deny-deletes-dry-run", Effect: EffectDeny, Actions: []string{"users:delete"}, Resources: []string{"user"}, DryRun: true},
+	}}
+
+	engine, err := NewEngine(nil, file, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		action     string
+		department string
+		roles      []string
+		fallback   bool
+		wantAllow  bool
+		wantPolicy string
+	}{
+		{"deny overrides an earlier allow", "users:write", "sales", []string{"admin"}, true, false, "deny-admins"},
+		{"deny overrides a later allow", "users:write", "support", []string{"user", "admin"}, true, false, "deny-admins"},
+		{"first matching allow decides", "users:write", "sales", []string{"user"}, false, true, "allow-sales"},
+		{"later allow applies when earlier ones don't match", "users:write", "support", []string{"user"}, false, true, "allow-all-writes"},
+		{"no policy falls back to permissions", "users:read", "support", []string{"user"}, true, true, ""},
+		{"no policy falls back to a missing permission", "users:read", "support", []string{"user"}, false, false, ""},
+		{"dry-run policies are not enforced", "users:delete", "support", []string{"user"}, true, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := &Input{
+				Action:  tt.action,
+				Subject: Attributes{"department": tt.department},
+				Resource: Resource{
+					Type:       "user",
+					ID:         "2",
+					Attributes: Attributes{"roles": tt.roles},
+				},
+			}
+
+			allowed, policyID := engine.Evaluate(in, tt.fallback)
+			if allowed != tt.wantAllow || policyID != tt.wantPolicy {
+				t.Errorf("Evaluate() = (%v, %q), want (%v, %q)", allowed, policyID, tt.wantAllow, tt.wantPolicy)
+			}
+		})
+	}
+
+	in := &Input{Action: "users:delete", Resource: Resource{Type: "user"}}
+	if !engine.hasDryRun(in) {
+		t.Error("hasDryRun() = false, want true")
+	}
+	if allowed, policyID := engine.decide(in, true, true); allowed || policyID != "deny-deletes-dry-run" {
+		t.Errorf("decide() in dry run = (%v, %q), want (false, %q)", allowed, policyID, "deny-deletes-dry-run")
+	}
+}
+
+func TestEngineRequire(t *testing.T) {
+	// Queries are only built, never run; the subject's department stays empty
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := &File{Policies: []Policy{
+		{ID: "deny-audit-reads", Effect: EffectDeny, Actions: []string{models.PermissionAuditRead}, Resources: []string{"route"},
+			Condition: &Condition{Attr: "subject.roles", Op: "contains", Value: "auditor"}},
+	}}
+	engine, err := NewEngine(db, file, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		claims     *models.JWTCustomClaims
+		wantStatus int
+	}{
+		{"permission granted", &models.JWTCustomClaims{UserID: 1, Roles: []string{"admin"}, Permissions: []string{models.PermissionAuditRead}}, fiber.StatusOK},
+		{"deny policy overrides the permission", &models.JWTCustomClaims{UserID: 2, Roles: []string{"auditor"}, Permissions: []string{models.PermissionAuditRead}}, fiber.StatusForbidden},
+		{"permission missing", &models.JWTCustomClaims{UserID: 3, Roles: []string{"user"}}, fiber.StatusForbidden},
+		{"unauthenticated", nil, fiber.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if tt.claims != nil {
+					c.Locals("current_user", tt.claims)
+				}
+				return c.Next()
+			})
+			app.Get("/admin/audit-logs", engine.Require(models.PermissionAuditRead), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/admin/audit-logs", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("GET /admin/audit-logs = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"time"
+)
+
+// Policy effects
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// File is the format of the policy file
+type File struct {
+	// Timezone is the IANA time zone request.hour and request.weekday are computed in; defaults to UTC
+	Timezone string   `json:"timezone"`
+	Policies []Policy `json:"policies"`
+}
+
+// Policy allows or denies actions on resources when its condition holds.
+// Actions and resources are glob patterns such as "users:*" or "*".
+// A dry-run policy is evaluated and logged but never changes a decision.
+type Policy struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Effect      string     `json:"effect"`
+	Actions     []string   `json:"actions"`
+	Resources   []string   `json:"resources"`
+	Condition   *Condition `json:"condition"`
+	DryRun      bool       `json:"dry_run"`
+}
+
+// LoadFile reads and validates a policy file
+func LoadFile(filename string) (*File, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var file File
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	if err := file.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &file, nil
+}
+
+// Validate checks that every policy is well-formed, so that mistakes surface at startup
+// rather than as surprising decisions
+func (f *File) Validate() error {
+	if f.Timezone != "" {
+		if _, err := time.LoadLocation(f.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q", f.Timezone)
+		}
+	}
+
+	var ids []string
+	for i, policy := range f.Policies {
+		if policy.ID == "" {
+			return fmt.Errorf("policy %d has no id", i+1)
+		}
+		if slices.Contains(ids, policy.ID) {
+			return fmt.Errorf("duplicate policy id %q", policy.ID)
+		}
+		ids = append(ids, policy.ID)
+
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("policy %q: %w", policy.ID, err)
+		}
+	}
+	return nil
+}
+
+// validate checks the effect, patterns and condition of a policy
+func (p *Policy) validate() error {
+	if p.Effect != EffectAllow && p.Effect != EffectDeny {
+		return fmt.Errorf("effect must be %q or %q", EffectAllow, EffectDeny)
+	}
+	if len(p.Actions) == 0 {
+		return errors.New("no actions")
+	}
+	if len(p.Resources) == 0 {
+		return errors.New("no resources")
+	}
+
+	for _, pattern := range append(slices.Clone(p.Actions), p.Resources...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+
+	if p.Condition != nil {
+		return p.Condition.validate()
+	}
+	return nil
+}
+
+// applies reports whether the policy covers an action on a resource type
+func (p *Policy) applies(action, resourceType string) bool {
+	return matchesAny(p.Actions, action) && matchesAny(p.Resources, resourceType)
+}
+
+// matchesAny reports whether value matches one of the glob patterns
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package policy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"valid", `{"timezone": "Europe/Berlin", "policies": [
+			{"id": "a", "effect": "allow", "actions": ["users:*"], "resources": ["user"],
+			 "condition": {"not": {"attr": "resource.roles", "op": "contains", "value": "admin"}}}
+		]}`, ""},
+		{"no condition", `{"policies": [{"id": "a", "effect": "deny", "actions": ["*"], "resources": ["*"]}]}`, ""},
+		{"invalid timezone", `{"timezone": "Mars/Olympus", "policies": []}`, "invalid timezone"},
+		{"missing id", `{"policies": [{"effect": "allow", "actions": ["*"], "resources": ["*"]}]}`, "has no id"},
+		{"duplicate id", `{"policies": [
+			{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"]},
+			{"id": "a", "effect": "deny", "actions": ["*"], "resources": ["*"]}
+		]}`, "duplicate policy id"},
+		{"unknown effect", `{"policies": [{"id": "a", "effect": "permit", "actions": ["*"], "resources": ["*"]}]}`, "effect must be"},
+		{"no actions", `{"policies": [{"id": "a", "effect": "allow", "resources": ["*"]}]}`, "no actions"},
+		{"no resources", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"]}]}`, "no resources"},
+		{"invalid pattern", `{"policies": [{"id": "a", "effect": "allow", "actions": ["users:["], "resources": ["*"]}]}`, "invalid pattern"},
+		{"two kinds in one condition", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"],
+			"condition": {"attr": "subject.role", "op": "eq", "value": "admin", "not": {"attr": "subject.api_key", "op": "eq", "value": true}}}]}`, "exactly one of"},
+		{"unknown attribute set", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"],
+			"condition": {"attr": "user.role", "op": "eq", "value": "admin"}}]}`, "must start with"},
+		{"unknown operator", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"],
+			"condition": {"attr": "subject.role", "op": "like", "value": "admin"}}]}`, "unknown operator"},
+		{"value and ref", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"],
+			"condition": {"attr": "subject.department", "op": "eq", "value": "sales", "ref": "resource.department"}}]}`, "either a value or a ref"},
+		{"exists with a value", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"],
+			"condition": {"attr": "subject.department", "op": "exists", "value": "sales"}}]}`, "takes no value"},
+		{"in without a list", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"],
+			"condition": {"attr": "request.weekday", "op": "in", "value": "sunday"}}]}`, "needs a list value"},
+		{"invalid nested condition", `{"policies": [{"id": "a", "effect": "allow", "actions": ["*"], "resources": ["*"],
+			"condition": {"any": [{"attr": "subject.role", "op": "eq"}]}}]}`, "either a value or a ref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file File
+			if err := json.Unmarshal([]byte(tt.file), &file); err != nil {
+				t.Fatalf("parse file: %v", err)
+			}
+
+			err := file.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadExampleFile(t *testing.T) {
+	if _, err := LoadFile("../../policies.example.json"); err != nil {
+		t.Fatalf("LoadFile() = %v", err)
+	}
+}
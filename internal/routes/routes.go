@@ -1,9 +1,17 @@
 package routes
 
 import (
+	"log"
+
+	"golang-base/internal/auth"
 	"golang-base/internal/config"
 	"golang-base/internal/handlers"
+	"golang-base/internal/mailer"
 	"golang-base/internal/middleware"
+	"golang-base/internal/models"
+	"golang-base/internal/oidc"
+	"golang-base/internal/passkey"
+	"golang-base/internal/policy"
 
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
@@ -11,43 +19,192 @@ import (
 
 // Setup configures all routes for the application
 func Setup(app *fiber.App, db *gorm.DB, cfg *config.Config) {
+	// Initialize shared services
+	cipher, err := auth.NewCipher(cfg.EncryptionSecret())
+	if err != nil {
+		log.Fatal("Failed to initialize encryption:", err)
+	}
+
+	keys, err := auth.NewKeyManager(db, cfg, cipher)
+	if err != nil {
+		log.Fatal("Failed to initialize signing keys:", err)
+	}
+	keys.Start()
+
+	tokens := auth.NewTokenIssuer(cfg, keys)
+	revocations := auth.NewRevocationList(db, cfg.RevocationCacheTTL)
+	revocations.Start()
+	guard := auth.NewLoginGuard(db, cfg)
+	apiKeys := auth.NewAPIKeyStore(db)
+	hierarchy, err := auth.ParseRoleHierarchy(cfg.RoleHierarchy)
+	if err != nil {
+		log.Fatal("Invalid ROLE_HIERARCHY:", err)
+	}
+	access := auth.NewAccessControl(db, cfg.RevocationCacheTTL, hierarchy)
+	policies, err := policy.Load(db, cfg)
+	if err != nil {
+		log.Fatal("Failed to load policies:", err)
+	}
+	mail := mailer.New(cfg)
+	passkeys, err := passkey.NewService(db, cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize WebAuthn:", err)
+	}
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, cfg)
-	userHandler := handlers.NewUserHandler(db, cfg)
-	webHandler := handlers.NewWebHandler()
+	authHandler := handlers.NewAuthHandler(db, cfg, tokens, revocations, guard, mail)
+	userHandler := handlers.NewUserHandler(db, cfg, tokens, revocations, access, policies)
+	mfaHandler := handlers.NewMFAHandler(db, cfg, tokens, revocations, guard, cipher, passkeys)
+	oidcHandler := handlers.NewOIDCHandler(db, cfg, tokens, guard, cipher, oidc.NewClient(cfg))
+	oauthHandler := handlers.NewOAuthHandler(db, cfg, tokens, revocations)
+	apiKeyHandler := handlers.NewAPIKeyHandler(db, cfg)
+	auditHandler := handlers.NewAuditHandler(db)
+	roleHandler := handlers.NewRoleHandler(db, access)
+	organizationHandler := handlers.NewOrganizationHandler(db, cfg, tokens, access)
+	invitationHandler := handlers.NewInvitationHandler(db, cfg, mail, access)
+	webAuthnHandler := handlers.NewWebAuthnHandler(db, cfg, tokens, guard, passkeys)
+	sessionHandler := handlers.NewSessionHandler(db, cfg, revocations)
+	webHandler := handlers.NewWebHandler(cfg)
+	wellKnownHandler := handlers.NewWellKnownHandler(cfg, keys)
 
 	// API routes
 	api := app.Group("/api/v1")
 
 	// Public routes
-	auth := api.Group("/auth")
-	auth.Post("/register", authHandler.Register)
-	auth.Post("/login", authHandler.Login)
-	auth.Post("/refresh", authHandler.RefreshToken)
+	jwtAuth := middleware.JWTAuth(tokens, revocations, apiKeys, access)
+	requireSession := middleware.RequireSession()
+	blockImpersonation := middleware.BlockImpersonation()
+	webAuth := middleware.WebAuth(db, cfg, tokens, revocations, access)
+
+	authRoutes := api.Group("/auth")
+	authRoutes.Post("/register", authHandler.Register)
+	authRoutes.Post("/login", authHandler.Login)
+	authRoutes.Post("/refresh", authHandler.RefreshToken)
+	authRoutes.Post("/verify-email", authHandler.VerifyEmail)
+	authRoutes.Post("/resend-verification", authHandler.ResendVerification)
+	authRoutes.Post("/forgot-password", authHandler.ForgotPassword)
+	authRoutes.Post("/reset-password", authHandler.ResetPassword)
+	authRoutes.Post("/magic-link", authHandler.RequestMagicLink)
+	authRoutes.Post("/magic-link/verify", authHandler.VerifyMagicLink)
+	authRoutes.Post("/invitation", invitationHandler.GetInvitation)
+	authRoutes.Post("/invitation/accept", invitationHandler.AcceptInvitation)
+	authRoutes.Post("/invitation/decline", invitationHandler.DeclineInvitation)
+	authRoutes.Post("/mfa/verify", mfaHandler.Verify)
+	authRoutes.Post("/mfa/enroll", mfaHandler.Enroll)
+	authRoutes.Post("/mfa/enroll/confirm", mfaHandler.EnrollConfirm)
+	authRoutes.Post("/mfa/webauthn/begin", mfaHandler.WebAuthnBegin)
+	authRoutes.Post("/mfa/webauthn/verify", mfaHandler.WebAuthnVerify)
+	authRoutes.Post("/webauthn/login/begin", webAuthnHandler.LoginBegin)
+	authRoutes.Post("/webauthn/login/finish", webAuthnHandler.LoginFinish)
+	authRoutes.Get("/oidc/login", oidcHandler.Login)
+	authRoutes.Get("/oidc/callback", oidcHandler.Callback)
+	authRoutes.Post("/logout", jwtAuth, requireSession, authHandler.Logout)
+	authRoutes.Post("/logout-all", jwtAuth, requireSession, blockImpersonation, authHandler.LogoutAll)
+	authRoutes.Post("/impersonation/stop", jwtAuth, userHandler.StopImpersonation)
+
+	// Resources for third-party OAuth clients, authenticated with their own access tokens
+	oauthAuth := middleware.OAuthAuth(tokens, revocations)
+	api.Get("/oauth/userinfo", oauthAuth, middleware.RequireScope("profile", "email"), oauthHandler.UserInfo)
 
 	// Protected routes
 	protected := api.Group("/")
-	protected.Use(middleware.JWTAuth(cfg.JWTSecret))
+	protected.Use(jwtAuth, middleware.ResolveTenant(db, cfg, access))
 
 	// User routes
 	users := protected.Group("/users")
 	users.Get("/profile", userHandler.GetProfile)
 	users.Put("/profile", userHandler.UpdateProfile)
-	users.Delete("/profile", userHandler.DeleteProfile)
+	users.Delete("/profile", requireSession, blockImpersonation, userHandler.DeleteProfile)
+	users.Put("/password", requireSession, blockImpersonation, userHandler.ChangePassword)
+	users.Post("/mfa/totp/setup", requireSession, blockImpersonation, mfaHandler.SetupTOTP)
+	users.Get("/mfa/totp/qr", requireSession, blockImpersonation, mfaHandler.TOTPQRCode)
+	users.Post("/mfa/totp/enable", requireSession, blockImpersonation, mfaHandler.EnableTOTP)
+	users.Post("/mfa/totp/disable", requireSession, blockImpersonation, mfaHandler.DisableTOTP)
+	users.Post("/mfa/recovery-codes", requireSession, blockImpersonation, mfaHandler.RegenerateRecoveryCodes)
+	users.Post("/webauthn/register/begin", requireSession, blockImpersonation, webAuthnHandler.RegisterBegin)
+	users.Post("/webauthn/register/finish", requireSession, blockImpersonation, webAuthnHandler.RegisterFinish)
+	users.Get("/webauthn/credentials", requireSession, webAuthnHandler.GetCredentials)
+	users.Delete("/webauthn/credentials/:id", requireSession, blockImpersonation, webAuthnHandler.DeleteCredential)
+	users.Get("/sessions", requireSession, sessionHandler.GetSessions)
+	users.Delete("/sessions", requireSession, blockImpersonation, sessionHandler.RevokeOtherSessions)
+	users.Delete("/sessions/:id", requireSession, blockImpersonation, sessionHandler.RevokeSession)
+	users.Get("/identities", requireSession, oidcHandler.GetIdentities)
+	users.Delete("/identities/:id", requireSession, blockImpersonation, oidcHandler.DeleteIdentity)
+	users.Get("/oauth/consents", requireSession, oauthHandler.GetConsents)
+	users.Delete("/oauth/consents/:client_id", requireSession, blockImpersonation, oauthHandler.DeleteConsent)
+	users.Get("/api-keys", requireSession, apiKeyHandler.GetAPIKeys)
+	users.Post("/api-keys", requireSession, blockImpersonation, apiKeyHandler.CreateAPIKey)
+	users.Delete("/api-keys/:id", requireSession, blockImpersonation, apiKeyHandler.RevokeAPIKey)
+	users.Get("/organizations", organizationHandler.GetMyOrganizations)
+	users.Put("/organization", requireSession, blockImpersonation, organizationHandler.SwitchOrganization)
+	users.Get("/:id<int>", middleware.RequireSelfOrPermission("id", models.PermissionUsersRead), userHandler.GetUserByID)
 
-	// Admin routes
+	// Admin routes, each guarded by the permission it needs through the policy engine, so deny
+	// policies apply to all of them. Within an organization, writes to an account are confined
+	// to accounts the organization controls.
 	admin := protected.Group("/admin")
-	admin.Use(middleware.RequireRole("admin"))
-	admin.Get("/users", userHandler.GetAllUsers)
-	admin.Get("/users/:id", userHandler.GetUserByID)
-	admin.Put("/users/:id", userHandler.UpdateUser)
-	admin.Delete("/users/:id", userHandler.DeleteUser)
+	admin.Use(blockImpersonation)
+	confine := func(permission string) fiber.Handler {
+		return middleware.ConfineToTenant(db, access, "id", permission)
+	}
+	admin.Get("/users", policies.Require(models.PermissionUsersRead), userHandler.GetAllUsers)
+	admin.Post("/users", policies.Require(models.PermissionUsersWrite), userHandler.CreateUser)
+	admin.Post("/users/import", policies.Require(models.PermissionUsersWrite), userHandler.ImportUsers)
+	admin.Get("/users/export", policies.Require(models.PermissionUsersRead), userHandler.ExportUsers)
+	admin.Get("/users/:id", policies.Require(models.PermissionUsersRead), userHandler.GetUserByID)
+	// Authorized by the policy engine in the handler, since policies may depend on the user being changed
+	admin.Put("/users/:id", confine(models.PermissionUsersWrite), userHandler.UpdateUser)
+	admin.Delete("/users/:id", confine(models.PermissionUsersDelete), userHandler.DeleteUser)
+	admin.Post("/users/:id/unlock", confine(models.PermissionUsersWrite), userHandler.UnlockUser)
+	admin.Post("/users/:id/impersonate", requireSession, policies.Require(models.PermissionUsersImpersonate), confine(models.PermissionUsersImpersonate), userHandler.ImpersonateUser)
+	admin.Get("/users/:id/roles", policies.Require(models.PermissionRolesManage), roleHandler.GetUserRoles)
+	admin.Put("/users/:id/roles", policies.Require(models.PermissionRolesManage), confine(models.PermissionRolesManage), roleHandler.SetUserRoles)
+	admin.Get("/users/:id/sessions", policies.Require(models.PermissionSessionsManage), sessionHandler.GetUserSessions)
+	admin.Delete("/users/:id/sessions", policies.Require(models.PermissionSessionsManage), confine(models.PermissionSessionsManage), sessionHandler.RevokeUserSessions)
+	admin.Delete("/users/:id/sessions/:session_id", policies.Require(models.PermissionSessionsManage), confine(models.PermissionSessionsManage), sessionHandler.RevokeUserSession)
+	admin.Get("/roles", policies.Require(models.PermissionRolesManage), roleHandler.GetRoles)
+	admin.Post("/roles", policies.Require(models.PermissionRolesManage), roleHandler.CreateRole)
+	admin.Put("/roles/:name", policies.Require(models.PermissionRolesManage), roleHandler.UpdateRole)
+	admin.Delete("/roles/:name", policies.Require(models.PermissionRolesManage), roleHandler.DeleteRole)
+	admin.Get("/permissions", policies.Require(models.PermissionRolesManage), roleHandler.GetPermissions)
+	admin.Get("/organizations", policies.Require(models.PermissionOrganizations), organizationHandler.GetOrganizations)
+	admin.Post("/organizations", policies.Require(models.PermissionOrganizations), organizationHandler.CreateOrganization)
+	admin.Delete("/organizations/:id<int>", policies.Require(models.PermissionOrganizations), organizationHandler.DeleteOrganization)
+	admin.Get("/organizations/:id<int>/members", policies.Require(models.PermissionOrganizations), organizationHandler.GetMembers)
+	admin.Put("/organizations/:id<int>/members/:user_id<int>", policies.Require(models.PermissionOrganizations), organizationHandler.SetMember)
+	admin.Delete("/organizations/:id<int>/members/:user_id<int>", policies.Require(models.PermissionOrganizations), organizationHandler.RemoveMember)
+	admin.Get("/invitations", policies.Require(models.PermissionUsersInvite), invitationHandler.GetInvitations)
+	admin.Post("/invitations", policies.Require(models.PermissionUsersInvite), invitationHandler.CreateInvitation)
+	admin.Delete("/invitations/:id<int>", policies.Require(models.PermissionUsersInvite), invitationHandler.RevokeInvitation)
+	admin.Get("/audit-logs", policies.Require(models.PermissionAuditRead), auditHandler.GetAuditLogs)
+	admin.Get("/mfa/policies", policies.Require(models.PermissionMFAManage), mfaHandler.GetRolePolicies)
+	admin.Put("/mfa/policies/:role", policies.Require(models.PermissionMFAManage), mfaHandler.UpdateRolePolicy)
+	admin.Get("/oauth/clients", policies.Require(models.PermissionOAuthClients), oauthHandler.GetClients)
+	admin.Post("/oauth/clients", policies.Require(models.PermissionOAuthClients), oauthHandler.CreateClient)
+	admin.Delete("/oauth/clients/:client_id", policies.Require(models.PermissionOAuthClients), oauthHandler.DeleteClient)
 
 	// Web routes (serving HTML pages)
 	app.Get("/", webHandler.Index)
 	app.Get("/login", webHandler.Login)
 	app.Get("/register", webHandler.Register)
-	app.Get("/dashboard", middleware.WebAuth(), webHandler.Dashboard)
+	app.Get("/verify-email", webHandler.VerifyEmail)
+	app.Get("/forgot-password", webHandler.ForgotPassword)
+	app.Get("/reset-password", webHandler.ResetPassword)
+	app.Get("/magic-link", webHandler.MagicLink)
+	app.Get("/invitation", webHandler.Invitation)
+	app.Get("/dashboard", webAuth, webHandler.Dashboard)
+	app.Post("/logout", webAuth, authHandler.WebLogout)
+
+	// OAuth 2.0 authorization server
+	app.Get("/oauth/authorize", webAuth, oauthHandler.Authorize)
+	app.Post("/oauth/authorize", webAuth, oauthHandler.Decide)
+	app.Post("/oauth/token", oauthHandler.Token)
+	app.Post("/oauth/introspect", oauthHandler.Introspect)
+	app.Post("/oauth/revoke", oauthHandler.Revoke)
+
+	// Discovery documents
+	app.Get("/.well-known/jwks.json", wellKnownHandler.JWKS)
+	app.Get("/.well-known/oauth-authorization-server", wellKnownHandler.OAuthMetadata)
 
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -0,0 +1,137 @@
+// Package tenant confines database queries to the organization a request is made in.
+package tenant
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type contextKey struct{}
+
+// WithOrganization returns a context whose queries are confined to the organization
+func WithOrganization(ctx context.Context, organizationID uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, organizationID)
+}
+
+// OrganizationID returns the organization of a context, if it has one
+func OrganizationID(ctx context.Context) (uint, bool) {
+	organizationID, ok := ctx.Value(contextKey{}).(uint)
+	return organizationID, ok && organizationID != 0
+}
+
+// Scoped is implemented by models whose rows belong to organizations. TenantScope returns
+// the condition selecting the rows of one organization.
+type Scoped interface {
+	TenantScope(organizationID uint) clause.Expression
+}
+
+// Plugin adds the tenant condition to every query, update and delete of a Scoped model
+// run with a context from WithOrganization, such as db.WithContext(c.UserContext()).
+// Rows of other organizations can then neither be read nor changed, whatever the
+// query's own conditions are.
+type Plugin struct{}
+
+// Name implements gorm.Plugin
+func (Plugin) Name() string {
+	return "tenant"
+}
+
+// Initialize implements gorm.Plugin
+func (Plugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("tenant:scope", scopeRead); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tenant:scope", scopeRead); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenant:scope", scopeWrite); err != nil {
+		return err
+	}
+	return callbacks.Delete().Before("gorm:delete").Register("tenant:scope", scopeWrite)
+}
+
+// scopeRead adds the tenant condition to a query
+func scopeRead(db *gorm.DB) {
+	if condition := tenantCondition(db); condition != nil {
+		addCondition(db, condition)
+	}
+}
+
+// scopeWrite adds the tenant condition to an update or delete. GORM refuses updates and
+// deletes without conditions, but would accept the tenant condition as one, so that check
+// is made here first.
+func scopeWrite(db *gorm.DB) {
+	condition := tenantCondition(db)
+	if condition == nil {
+		return
+	}
+	if missingWhere(db) {
+		_ = db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	addCondition(db, condition)
+}
+
+// tenantCondition returns the tenant condition for a statement, or nil when the statement
+// is not made within an organization or its model is not Scoped
+func tenantCondition(db *gorm.DB) clause.Expression {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil
+	}
+	organizationID, ok := OrganizationID(db.Statement.Context)
+	if !ok {
+		return nil
+	}
+
+	model, ok := reflect.New(db.Statement.Schema.ModelType).Interface().(Scoped)
+	if !ok {
+		return nil
+	}
+	return model.TenantScope(organizationID)
+}
+
+// addCondition adds a condition to a statement. The statement's own conditions are
+// grouped first, so that an OR among them cannot escape the tenant.
+func addCondition(db *gorm.DB, condition clause.Expression) {
+	where, ok := db.Statement.Clauses["WHERE"]
+	if !ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{condition}})
+		return
+	}
+
+	exprs := []clause.Expression{condition}
+	if existing, ok := where.Expression.(clause.Where); ok && len(existing.Exprs) > 0 {
+		exprs = []clause.Expression{clause.And(existing.Exprs...), condition}
+	}
+	where.Expression = clause.Where{Exprs: exprs}
+	db.Statement.Clauses["WHERE"] = where
+}
+
+// missingWhere reports whether an update or delete has neither conditions nor a model
+// with a primary key to build them from
+func missingWhere(db *gorm.DB) bool {
+	if db.AllowGlobalUpdate {
+		return false
+	}
+	if _, ok := db.Statement.Clauses["WHERE"]; ok {
+		return false
+	}
+
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	value := reflect.Indirect(db.Statement.ReflectValue)
+	if field == nil {
+		return true
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		_, zero := field.ValueOf(db.Statement.Context, value)
+		return zero
+	case reflect.Slice, reflect.Array:
+		return value.Len() == 0
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    client_id TEXT NOT NULL UNIQUE,
+    client_secret_hash TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    public BOOLEAN NOT NULL DEFAULT FALSE,
+    redirect_uris TEXT NOT NULL DEFAULT '',
+    grant_types TEXT NOT NULL DEFAULT '',
+    scopes TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+DROP TRIGGER IF EXISTS set_oauth_clients_updated_at ON oauth_clients;
+CREATE TRIGGER set_oauth_clients_updated_at
+BEFORE UPDATE ON oauth_clients
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    code_hash TEXT NOT NULL UNIQUE,
+    client_id TEXT NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    code_challenge TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_client_id ON oauth_authorization_codes (client_id);
+CREATE INDEX IF NOT EXISTS idx_oauth_authorization_codes_user_id ON oauth_authorization_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS oauth_consents (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id TEXT NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+    scope TEXT NOT NULL DEFAULT '',
+
+    UNIQUE (user_id, client_id)
+);
+
+DROP TRIGGER IF EXISTS set_oauth_consents_updated_at ON oauth_consents;
+CREATE TRIGGER set_oauth_consents_updated_at
+BEFORE UPDATE ON oauth_consents
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+-- Tokens issued through the client credentials grant belong to no user
+ALTER TABLE revoked_tokens ALTER COLUMN user_id DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM revoked_tokens WHERE user_id IS NULL;
+ALTER TABLE revoked_tokens ALTER COLUMN user_id SET NOT NULL;
+DROP TRIGGER IF EXISTS set_oauth_consents_updated_at ON oauth_consents;
+DROP TABLE IF EXISTS oauth_consents;
+DROP INDEX IF EXISTS idx_oauth_authorization_codes_user_id;
+DROP INDEX IF EXISTS idx_oauth_authorization_codes_client_id;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TRIGGER IF EXISTS set_oauth_clients_updated_at ON oauth_clients;
+DROP TABLE IF EXISTS oauth_clients;
+-- +goose StatementEnd
@@ -0,0 +1,79 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS permissions (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    built_in BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+DROP TRIGGER IF EXISTS set_roles_updated_at ON roles;
+CREATE TRIGGER set_roles_updated_at
+BEFORE UPDATE ON roles
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles (role_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'List and view users'),
+    ('users:write', 'Update and unlock users'),
+    ('users:delete', 'Delete users'),
+    ('users:impersonate', 'Act as a user without permissions'),
+    ('sessions:manage', 'List and revoke the sessions of any user'),
+    ('roles:manage', 'Manage roles and assign them to users'),
+    ('mfa:manage', 'Manage per-role MFA requirements'),
+    ('oauth_clients:manage', 'Register and delete OAuth clients'),
+    ('audit:read', 'Read the audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO roles (name, description, built_in) VALUES
+    ('admin', 'Full access to every admin API', TRUE),
+    ('user', 'Regular user without admin permissions', TRUE)
+ON CONFLICT (name) DO UPDATE SET built_in = TRUE;
+
+-- Every role already in use becomes a role that can be managed
+INSERT INTO roles (name)
+SELECT DISTINCT role FROM users WHERE role IS NOT NULL AND role <> ''
+ON CONFLICT (name) DO NOTHING;
+
+-- The admin role holds every permission; the rows keep listings accurate
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions
+WHERE roles.name = 'admin'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_user_roles_role_id;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TRIGGER IF EXISTS set_roles_updated_at ON roles;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS permissions;
+-- +goose StatementEnd
@@ -0,0 +1,70 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE
+);
+
+DROP TRIGGER IF EXISTS set_organizations_updated_at ON organizations;
+CREATE TRIGGER set_organizations_updated_at
+BEFORE UPDATE ON organizations
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+CREATE TABLE IF NOT EXISTS memberships (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    organization_id INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'user'
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_memberships_organization_user ON memberships (organization_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_memberships_user_id ON memberships (user_id);
+
+DROP TRIGGER IF EXISTS set_memberships_updated_at ON memberships;
+CREATE TRIGGER set_memberships_updated_at
+BEFORE UPDATE ON memberships
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS organization_id INTEGER NULL REFERENCES organizations (id) ON DELETE SET NULL;
+
+INSERT INTO permissions (name, description) VALUES
+    ('organizations:manage', 'Manage organizations and their members')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions
+WHERE roles.name = 'admin' AND permissions.name = 'organizations:manage'
+ON CONFLICT DO NOTHING;
+
+-- Administrators of a single organization; as a membership role it only applies within it
+INSERT INTO roles (name, description, built_in) VALUES
+    ('org_admin', 'Manage the users of an organization', TRUE)
+ON CONFLICT (name) DO UPDATE SET built_in = TRUE;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions
+WHERE roles.name = 'org_admin' AND permissions.name IN ('users:read', 'users:write', 'sessions:manage')
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM roles WHERE name = 'org_admin';
+DELETE FROM permissions WHERE name = 'organizations:manage';
+ALTER TABLE sessions DROP COLUMN IF EXISTS organization_id;
+DROP TRIGGER IF EXISTS set_memberships_updated_at ON memberships;
+DROP INDEX IF EXISTS idx_memberships_user_id;
+DROP INDEX IF EXISTS idx_memberships_organization_user;
+DROP TABLE IF EXISTS memberships;
+DROP TRIGGER IF EXISTS set_organizations_updated_at ON organizations;
+DROP TABLE IF EXISTS organizations;
+-- +goose StatementEnd
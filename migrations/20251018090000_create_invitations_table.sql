@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS invitations (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    organization_id INTEGER NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    invited_by_id INTEGER NULL REFERENCES users (id) ON DELETE SET NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ NULL,
+    declined_at TIMESTAMPTZ NULL,
+    revoked_at TIMESTAMPTZ NULL,
+    user_id INTEGER NULL REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
+CREATE INDEX IF NOT EXISTS idx_invitations_organization_id ON invitations (organization_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:invite', 'Invite users by email with a preassigned role')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles CROSS JOIN permissions
+WHERE roles.name IN ('admin', 'org_admin') AND permissions.name = 'users:invite'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'users:invite';
+DROP INDEX IF EXISTS idx_invitations_organization_id;
+DROP INDEX IF EXISTS idx_invitations_email;
+DROP TABLE IF EXISTS invitations;
+-- +goose StatementEnd
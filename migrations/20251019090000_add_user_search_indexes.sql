@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Substring search on names and email addresses (ILIKE '%...%')
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_full_name_trgm ON users USING GIN ((first_name || ' ' || last_name) gin_trgm_ops);
+
+-- Word search; the expression must match the one the user listing queries with
+CREATE INDEX IF NOT EXISTS idx_users_search ON users USING GIN (to_tsvector('simple', first_name || ' ' || last_name || ' ' || email));
+
+-- Filters and the default sort orders of the user listing
+CREATE INDEX IF NOT EXISTS idx_users_role ON users (role);
+CREATE INDEX IF NOT EXISTS idx_users_created_at ON users (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_created_at;
+DROP INDEX IF EXISTS idx_users_role;
+DROP INDEX IF EXISTS idx_users_search;
+DROP INDEX IF EXISTS idx_users_full_name_trgm;
+DROP INDEX IF EXISTS idx_users_email_trgm;
+-- pg_trgm is left installed, since other schemas may use it
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE oauth_authorization_codes ADD COLUMN IF NOT EXISTS token_jti TEXT NULL;
+ALTER TABLE oauth_authorization_codes ADD COLUMN IF NOT EXISTS token_expires_at TIMESTAMPTZ NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS token_expires_at;
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS token_jti;
+-- +goose StatementEnd
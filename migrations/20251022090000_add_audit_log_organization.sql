@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS organization_id INTEGER NULL REFERENCES organizations (id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_audit_logs_organization_id ON audit_logs (organization_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_audit_logs_organization_id;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS organization_id;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+)
+
+// ParseBasicAuth decodes OAuth client credentials sent with HTTP Basic authentication.
+// Both parts are form-urlencoded before being joined (RFC 6749, section 2.3.1).
+func ParseBasicAuth(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+	username, err = url.QueryUnescape(username)
+	if err != nil {
+		return "", "", false
+	}
+	password, err = url.QueryUnescape(password)
+	if err != nil {
+		return "", "", false
+	}
+	return username, password, true
+}
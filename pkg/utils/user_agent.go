@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"net"
+	"strings"
+)
+
+// userAgentBrowsers maps User-Agent tokens to browser names. Order matters: Edge and
+// Opera also claim to be Chrome, and Chrome also claims to be Safari.
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"Go-http-client/", "Go HTTP client"},
+	{"python-requests/", "Python requests"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+// userAgentSystems maps User-Agent tokens to operating system names.
+// iPhone and Android user agents also mention Mac OS X and Linux.
+var userAgentSystems = []struct{ token, name string }{
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// DescribeUserAgent returns a short label such as "Firefox on Linux" for a User-Agent header
+func DescribeUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser, system := "", ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return "Unknown browser on " + system
+	default:
+		return "Unknown device"
+	}
+}
+
+// DescribeIPLocation returns a coarse location label for an IP address without a
+// geolocation lookup: loopback and private addresses are named as such, public
+// addresses are reduced to their /24 (IPv4) or /48 (IPv6) network.
+func DescribeIPLocation(address string) string {
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil:
+		return "Unknown location"
+	case ip.IsLoopback():
+		return "This machine"
+	case ip.IsPrivate(), ip.IsLinkLocalUnicast():
+		return "Local network"
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
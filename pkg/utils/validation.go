@@ -21,6 +21,14 @@ func FormatValidationErrors(err error) string {
 				errors = append(errors, e.Field()+" must be at least "+e.Param()+" characters")
 			case "max":
 				errors = append(errors, e.Field()+" must be at most "+e.Param()+" characters")
+			case "len":
+				errors = append(errors, e.Field()+" must be exactly "+e.Param()+" characters")
+			case "numeric":
+				errors = append(errors, e.Field()+" must be numeric")
+			case "required_without":
+				errors = append(errors, e.Field()+" is required when "+e.Param()+" is not provided")
+			case "nefield":
+				errors = append(errors, e.Field()+" must be different from "+e.Param())
 			default:
 				errors = append(errors, e.Field()+" is invalid")
 			}
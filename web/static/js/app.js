@@ -40,24 +40,15 @@ const Utils = {
         return emailRegex.test(email);
     },
     
-    // Get auth token from localStorage
-    getAuthToken: () => {
-        return localStorage.getItem('auth_token');
+    // Get the session's CSRF token from its (non-HttpOnly) cookie
+    getCSRFToken: () => {
+        const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+        return match ? decodeURIComponent(match[1]) : null;
     },
     
-    // Set auth token
-    setAuthToken: (token) => {
-        localStorage.setItem('auth_token', token);
-    },
-    
-    // Remove auth token
-    removeAuthToken: () => {
-        localStorage.removeItem('auth_token');
-    },
-    
-    // Check if user is authenticated
+    // Check if user is authenticated; the session tokens themselves are HttpOnly cookies
     isAuthenticated: () => {
-        return !!Utils.getAuthToken();
+        return !!Utils.getCSRFToken();
     }
 };
 
@@ -65,29 +56,54 @@ const Utils = {
 const API = {
     baseURL: '/api/v1',
     
-    // Make authenticated request
-    request: async (endpoint, options = {}) => {
-        const token = Utils.getAuthToken();
+    // Pending refresh, shared so that concurrent 401s rotate the refresh token only once
+    refreshing: null,
+    
+    // Exchange the session's refresh token cookie for a new token pair
+    refresh: () => {
+        if (!API.refreshing) {
+            API.refreshing = fetch(`${API.baseURL}/auth/refresh`, {
+                method: 'POST',
+                credentials: 'same-origin'
+            })
+                .then(response => response.ok)
+                .catch(() => false)
+                .finally(() => {
+                    API.refreshing = null;
+                });
+        }
+        return API.refreshing;
+    },
+    
+    // Make authenticated request using the session cookie
+    request: async (endpoint, options = {}, retried = false) => {
         const headers = {
             'Content-Type': 'application/json',
             ...options.headers
         };
         
-        if (token) {
-            headers.Authorization = `Bearer ${token}`;
+        const method = (options.method || 'GET').toUpperCase();
+        const csrfToken = Utils.getCSRFToken();
+        if (csrfToken && !['GET', 'HEAD', 'OPTIONS'].includes(method)) {
+            headers['X-CSRF-Token'] = csrfToken;
         }
         
         const config = {
             ...options,
-            headers
+            headers,
+            credentials: 'same-origin'
         };
         
         try {
             const response = await fetch(`${API.baseURL}${endpoint}`, config);
             
+            // Retry once with a refreshed token, then give up
+            if (response.status === 401 && !retried && await API.refresh()) {
+                return API.request(endpoint, options, true);
+            }
+            
             // Handle unauthorized responses
             if (response.status === 401) {
-                Utils.removeAuthToken();
                 window.location.href = '/login';
                 return;
             }
@@ -180,6 +196,81 @@ const Validation = {
     }
 };
 
+// WebAuthn helpers: the server sends and expects binary fields as base64url strings
+const Passkeys = {
+    // Check whether the browser supports passkeys
+    isSupported: () => {
+        return !!window.PublicKeyCredential;
+    },
+    
+    // Decode a base64url string to an ArrayBuffer
+    toBuffer: (value) => {
+        const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+        const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+        return Uint8Array.from(binary, c => c.charCodeAt(0)).buffer;
+    },
+    
+    // Encode an ArrayBuffer as a base64url string
+    fromBuffer: (buffer) => {
+        const binary = String.fromCharCode(...new Uint8Array(buffer));
+        return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    },
+    
+    // Register a new passkey from the server's creation options
+    create: async (options) => {
+        const publicKey = {
+            ...options.publicKey,
+            challenge: Passkeys.toBuffer(options.publicKey.challenge),
+            user: { ...options.publicKey.user, id: Passkeys.toBuffer(options.publicKey.user.id) },
+            excludeCredentials: (options.publicKey.excludeCredentials || []).map(credential => ({
+                ...credential,
+                id: Passkeys.toBuffer(credential.id)
+            }))
+        };
+        
+        const credential = await navigator.credentials.create({ publicKey });
+        return {
+            id: credential.id,
+            rawId: Passkeys.fromBuffer(credential.rawId),
+            type: credential.type,
+            authenticatorAttachment: credential.authenticatorAttachment,
+            clientExtensionResults: credential.getClientExtensionResults(),
+            response: {
+                clientDataJSON: Passkeys.fromBuffer(credential.response.clientDataJSON),
+                attestationObject: Passkeys.fromBuffer(credential.response.attestationObject),
+                transports: credential.response.getTransports ? credential.response.getTransports() : []
+            }
+        };
+    },
+    
+    // Sign the server's challenge with a passkey from the assertion options
+    get: async (options) => {
+        const publicKey = {
+            ...options.publicKey,
+            challenge: Passkeys.toBuffer(options.publicKey.challenge),
+            allowCredentials: (options.publicKey.allowCredentials || []).map(credential => ({
+                ...credential,
+                id: Passkeys.toBuffer(credential.id)
+            }))
+        };
+        
+        const credential = await navigator.credentials.get({ publicKey });
+        return {
+            id: credential.id,
+            rawId: Passkeys.fromBuffer(credential.rawId),
+            type: credential.type,
+            authenticatorAttachment: credential.authenticatorAttachment,
+            clientExtensionResults: credential.getClientExtensionResults(),
+            response: {
+                clientDataJSON: Passkeys.fromBuffer(credential.response.clientDataJSON),
+                authenticatorData: Passkeys.fromBuffer(credential.response.authenticatorData),
+                signature: Passkeys.fromBuffer(credential.response.signature),
+                userHandle: credential.response.userHandle ? Passkeys.fromBuffer(credential.response.userHandle) : null
+            }
+        };
+    }
+};
+
 // Helper functions for DOM manipulation
 function createToastContainer() {
     const container = document.createElement('div');